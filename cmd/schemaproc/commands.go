@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	jsonproc "github.com/iden3/go-schema-processor/v2/json"
+	"github.com/iden3/go-schema-processor/v2/merklize"
+	"github.com/iden3/go-schema-processor/v2/processor"
+	"github.com/iden3/go-schema-processor/v2/verifiable"
+)
+
+type validateResult struct {
+	Valid      bool                  `json:"valid"`
+	Violations []processor.Violation `json:"violations,omitempty"`
+}
+
+func runValidate(_ context.Context, args []string,
+	stdout, stderr io.Writer) error {
+
+	fs := newFlagSet(stderr, "validate", "<document>")
+	var lf loaderFlags
+	lf.register(fs)
+	schemaName := fs.String("schema", "", "JSON schema file or URL (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *schemaName == "" {
+		fs.Usage()
+		return errors.New("document and -schema are required")
+	}
+
+	loader, err := lf.loader()
+	if err != nil {
+		return err
+	}
+	schema, err := readDocument(loader, *schemaName)
+	if err != nil {
+		return fmt.Errorf("can't read schema: %w", err)
+	}
+	doc, err := readInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	v := jsonproc.NewValidator(jsonproc.WithDocumentLoader(loader))
+	err = v.ValidateData(doc, schema)
+	var validationErr *processor.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		err = writeJSON(stdout, validateResult{
+			Violations: validationErr.Violations})
+		if err != nil {
+			return err
+		}
+		return errFailed
+	case err != nil:
+		return err
+	}
+	return writeJSON(stdout, validateResult{Valid: true})
+}
+
+type entryResult struct {
+	Path     []any  `json:"path"`
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	RawValue any    `json:"rawValue"`
+	Datatype string `json:"datatype,omitempty"`
+}
+
+type merklizeResult struct {
+	Root    string        `json:"root"`
+	Entries []entryResult `json:"entries"`
+}
+
+func runMerklize(ctx context.Context, args []string,
+	stdout, stderr io.Writer) error {
+
+	fs := newFlagSet(stderr, "merklize", "<document>")
+	var lf loaderFlags
+	lf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("document is required")
+	}
+
+	loader, err := lf.loader()
+	if err != nil {
+		return err
+	}
+	doc, err := readInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	mz, err := merklize.MerklizeJSONLD(ctx, bytes.NewReader(doc),
+		merklize.WithDocumentLoader(loader))
+	if err != nil {
+		return err
+	}
+
+	entries := mz.Entries()
+	res := merklizeResult{
+		Root:    mz.Root().BigInt().String(),
+		Entries: make([]entryResult, len(entries)),
+	}
+	for i, e := range entries {
+		key, value, err := e.KeyValueMtEntries()
+		if err != nil {
+			return err
+		}
+		p := e.Key()
+		res.Entries[i] = entryResult{
+			Path:     p.Parts(),
+			Key:      key.String(),
+			Value:    value.String(),
+			RawValue: e.Value(),
+			Datatype: e.Datatype(),
+		}
+	}
+	return writeJSON(stdout, res)
+}
+
+type pathResult struct {
+	Path     []any  `json:"path"`
+	Key      string `json:"key"`
+	Datatype string `json:"datatype,omitempty"`
+}
+
+func runPath(_ context.Context, args []string,
+	stdout, stderr io.Writer) error {
+
+	fs := newFlagSet(stderr, "path", "<field path>")
+	var lf loaderFlags
+	lf.register(fs)
+	ctxName := fs.String("context", "",
+		"JSON-LD context file or URL to resolve the path in")
+	typeName := fs.String("type", "",
+		"type from the context the path is relative to, e.g. KYCAgeCredential")
+	docName := fs.String("document", "",
+		"JSON-LD document to resolve the path in instead of the context")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || (*ctxName == "") == (*docName == "") {
+		fs.Usage()
+		return errors.New("field path and one of -context or -document " +
+			"are required")
+	}
+
+	loader, err := lf.loader()
+	if err != nil {
+		return err
+	}
+	opts := merklize.Options{DocumentLoader: loader}
+	field := fs.Arg(0)
+
+	var res pathResult
+	var p merklize.Path
+	switch {
+	case *docName != "":
+		doc, err := readInput(*docName)
+		if err != nil {
+			return err
+		}
+		p, err = opts.NewPathFromDocument(doc, field)
+		if err != nil {
+			return err
+		}
+	case *typeName != "":
+		ldCtx, err := readDocument(loader, *ctxName)
+		if err != nil {
+			return err
+		}
+		p, err = opts.FieldPathFromContext(ldCtx, *typeName, field)
+		if err != nil {
+			return err
+		}
+		res.Datatype, err = opts.TypeFromContext(ldCtx,
+			*typeName+"."+field)
+		if err != nil {
+			return err
+		}
+	default:
+		ldCtx, err := readDocument(loader, *ctxName)
+		if err != nil {
+			return err
+		}
+		p, err = opts.PathFromContext(ldCtx, field)
+		if err != nil {
+			return err
+		}
+	}
+
+	key, err := p.MtEntry()
+	if err != nil {
+		return err
+	}
+	res.Path = p.Parts()
+	res.Key = key.String()
+	return writeJSON(stdout, res)
+}
+
+type claimResult struct {
+	Hex        string   `json:"hex"`
+	SchemaHash string   `json:"schemaHash"`
+	HIndex     string   `json:"hIndex"`
+	HValue     string   `json:"hValue"`
+	Slots      []string `json:"slots"`
+}
+
+func runClaim(ctx context.Context, args []string,
+	stdout, stderr io.Writer) error {
+
+	fs := newFlagSet(stderr, "claim", "<credential>")
+	var lf loaderFlags
+	lf.register(fs)
+	var opts verifiable.CoreClaimOptions
+	fs.Uint64Var(&opts.RevNonce, "rev-nonce", 0, "revocation nonce")
+	version := fs.Uint("version", 0, "claim version")
+	fs.StringVar(&opts.SubjectPosition, "subject-position",
+		verifiable.CredentialSubjectPositionIndex,
+		"position of the subject id: index, value or empty for none")
+	fs.StringVar(&opts.MerklizedRootPosition, "merklized-root-position",
+		verifiable.CredentialMerklizedRootPositionNone,
+		"position of the merklized root: index, value or empty to choose "+
+			"by the schema")
+	fs.BoolVar(&opts.Updatable, "updatable", false,
+		"set the updatable flag of the claim")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("credential is required")
+	}
+	opts.Version = uint32(*version)
+
+	loader, err := lf.loader()
+	if err != nil {
+		return err
+	}
+	opts.MerklizerOpts = []merklize.MerklizeOption{
+		merklize.WithDocumentLoader(loader)}
+
+	credential, err := readCredential(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	claim, err := credential.ToCoreClaim(ctx, &opts)
+	if err != nil {
+		return err
+	}
+
+	hIndex, hValue, err := claim.HiHv()
+	if err != nil {
+		return err
+	}
+	claimHex, err := claim.Hex()
+	if err != nil {
+		return err
+	}
+	schemaHash, err := claim.GetSchemaHash().MarshalText()
+	if err != nil {
+		return err
+	}
+	res := claimResult{
+		Hex:        claimHex,
+		SchemaHash: string(schemaHash),
+		HIndex:     hIndex.String(),
+		HValue:     hValue.String(),
+	}
+	for _, slot := range claim.RawSlotsAsInts() {
+		res.Slots = append(res.Slots, slot.String())
+	}
+	return writeJSON(stdout, res)
+}
+
+type verifyResult struct {
+	Valid     bool   `json:"valid"`
+	ProofType string `json:"proofType"`
+	Error     string `json:"error,omitempty"`
+}
+
+func runVerify(ctx context.Context, args []string,
+	stdout, stderr io.Writer) error {
+
+	fs := newFlagSet(stderr, "verify", "<credential>")
+	var lf loaderFlags
+	lf.register(fs)
+	proofType := fs.String("proof-type",
+		string(verifiable.BJJSignatureProofType),
+		"proof type to verify: BJJSignature2021 or "+
+			"Iden3SparseMerkleTreeProof")
+	resolverURL := fs.String("resolver-url", "",
+		"DID universal resolver URL, e.g. "+
+			"https://resolver.example.com/1.0/identifiers (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *resolverURL == "" {
+		fs.Usage()
+		return errors.New("credential and -resolver-url are required")
+	}
+
+	loader, err := lf.loader()
+	if err != nil {
+		return err
+	}
+	credential, err := readCredential(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	// only statuses that can be checked over plain HTTP are supported
+	registry := &verifiable.CredentialStatusResolverRegistry{}
+	registry.Register(verifiable.SparseMerkleTreeProof,
+		verifiable.IssuerResolver{})
+
+	err = credential.VerifyProof(ctx, verifiable.ProofType(*proofType),
+		verifiable.NewHTTPDIDResolver(*resolverURL, nil),
+		verifiable.WithStatusResolverRegistry(registry),
+		verifiable.WithMerklizeOptions(merklize.WithDocumentLoader(loader)))
+
+	res := verifyResult{Valid: err == nil, ProofType: *proofType}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if err := writeJSON(stdout, res); err != nil {
+		return err
+	}
+	if !res.Valid {
+		return errFailed
+	}
+	return nil
+}
+
+func readCredential(name string) (verifiable.W3CCredential, error) {
+	var credential verifiable.W3CCredential
+	credBytes, err := readInput(name)
+	if err != nil {
+		return credential, err
+	}
+	err = json.Unmarshal(credBytes, &credential)
+	return credential, err
+}
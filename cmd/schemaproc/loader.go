@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/iden3/go-schema-processor/v2/loaders"
+	"github.com/piprate/json-gold/ld"
+)
+
+const defaultIPFSGateway = "https://ipfs.io"
+
+// stringsFlag is a flag that may be repeated
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// loaderFlags configure the document loader shared by all commands
+type loaderFlags struct {
+	bundles     stringsFlag
+	docs        stringsFlag
+	pins        stringsFlag
+	rewrites    stringsFlag
+	ipfsGateway string
+	fileRoot    string
+	offline     bool
+}
+
+func (f *loaderFlags) register(fs *flag.FlagSet) {
+	fs.Var(&f.bundles, "bundle", "directory or tar archive with "+
+		loaders.BundleManifestFile+" mapping document URLs to files in "+
+		"the bundle (repeatable)")
+	fs.Var(&f.docs, "doc",
+		"offline document as url=file, e.g. "+
+			"https://www.w3.org/2018/credentials/v1=credentials-v1.jsonld "+
+			"(repeatable)")
+	fs.Var(&f.pins, "pin",
+		"pinned digest of a document as url=digest, e.g. "+
+			"https://www.w3.org/2018/credentials/v1=sha256-... (repeatable)")
+	fs.Var(&f.rewrites, "rewrite",
+		"URL prefix rewrite as prefix=replacement, e.g. "+
+			"https://schema.iden3.io/=https://mirror.example.com/iden3/ "+
+			"(repeatable)")
+	fs.StringVar(&f.ipfsGateway, "ipfs-gateway", defaultIPFSGateway,
+		"IPFS gateway URLs used to load ipfs:// documents, separated by "+
+			"commas and tried in order")
+	fs.StringVar(&f.fileRoot, "file-root", "",
+		"directory to load file:// documents from, they are not allowed "+
+			"if empty")
+	fs.BoolVar(&f.offline, "offline", false,
+		"fail on documents missing in bundles instead of downloading them")
+}
+
+func loadBundle(name string) (*loaders.Bundle, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return loaders.LoadBundleDir(name)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return loaders.LoadBundleTar(f)
+}
+
+func (f *loaderFlags) loader() (ld.DocumentLoader, error) {
+	loaderOpts := make([]loaders.DocumentLoaderOption, 0, len(f.bundles)+2)
+	for _, name := range f.bundles {
+		bundle, err := loadBundle(name)
+		if err != nil {
+			return nil, fmt.Errorf("can't load bundle %v: %w", name, err)
+		}
+		loaderOpts = append(loaderOpts, loaders.WithBundle(bundle))
+	}
+
+	cacheOpts := make([]loaders.MemoryCacheEngineOption, 0, len(f.docs))
+	for _, d := range f.docs {
+		u, fileName, err := splitDocFlag(d)
+		if err != nil {
+			return nil, err
+		}
+		docBytes, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		cacheOpts = append(cacheOpts,
+			loaders.WithEmbeddedDocumentBytes(u, docBytes))
+	}
+	cacheEngine, err := loaders.NewMemoryCacheEngine(cacheOpts...)
+	if err != nil {
+		return nil, err
+	}
+	loaderOpts = append(loaderOpts, loaders.WithCacheEngine(cacheEngine))
+
+	if f.offline {
+		loaderOpts = append(loaderOpts, loaders.WithOfflineMode())
+	}
+
+	for _, r := range f.rewrites {
+		prefix, replacement, ok := strings.Cut(r, "=")
+		if !ok || prefix == "" {
+			return nil, fmt.Errorf(
+				"invalid -rewrite value %q, want prefix=replacement", r)
+		}
+		loaderOpts = append(loaderOpts,
+			loaders.WithURLRewrite(prefix, replacement))
+	}
+
+	if f.fileRoot != "" {
+		loaderOpts = append(loaderOpts, loaders.WithFileURLs(f.fileRoot))
+	}
+
+	if len(f.pins) != 0 {
+		pins := make(map[string]string, len(f.pins))
+		for _, p := range f.pins {
+			// base64 digests may end with '=', so split before the algorithm
+			i := strings.LastIndex(p, "=sha")
+			if i <= 0 {
+				return nil, fmt.Errorf(
+					"invalid -pin value %q, want url=digest", p)
+			}
+			pins[p[:i]] = p[i+1:]
+		}
+		loaderOpts = append(loaderOpts, loaders.WithPinnedDigests(pins))
+	}
+
+	gateways := strings.Split(f.ipfsGateway, ",")
+	loaderOpts = append(loaderOpts, loaders.WithIPFSGateways(gateways[1:]...))
+
+	return loaders.NewDocumentLoader(nil, gateways[0], loaderOpts...), nil
+}
+
+// splitDocFlag splits -doc value into URL and file name. Both of them may
+// contain '=', e.g. in the query string, so the value is split at the first
+// '=' followed by the name of the existing file.
+func splitDocFlag(d string) (u, fileName string, err error) {
+	for i := 0; i < len(d); i++ {
+		if d[i] != '=' || i == 0 {
+			continue
+		}
+		fi, err := os.Stat(d[i+1:])
+		if err == nil && !fi.IsDir() {
+			return d[:i], d[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf(
+		"invalid -doc value %q, want url=file with existing file", d)
+}
+
+// readDocument reads the file, stdin if name is "-" or loads the document
+// with the loader if name is a URL
+func readDocument(loader ld.DocumentLoader, name string) ([]byte, error) {
+	u, err := url.Parse(name)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 {
+		// not a URL or a windows path with drive letter
+		return readInput(name)
+	}
+
+	doc, err := loader.LoadDocument(name)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc.Document)
+}
@@ -0,0 +1,118 @@
+// Command schemaproc is a command-line tool to validate, merklize and
+// process verifiable credentials with go-schema-processor.
+//
+// Usage:
+//
+//	schemaproc <command> [flags] [arguments]
+//
+// Commands:
+//
+//	validate  validate a JSON document against a JSON schema
+//	merklize  merklize a JSON-LD document and print the root and entries
+//	path      resolve a field path to merklize Path and its key hash
+//	claim     build a core claim from a credential
+//	verify    verify a credential proof
+//
+// All commands print results as JSON to stdout. Documents are loaded from
+// the network unless they are found in offline bundles passed with -bundle
+// or -doc flags.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// errFailed is returned by commands that already printed the negative result
+// (invalid document, failed proof) and only need the non-zero exit code
+var errFailed = errors.New("failed")
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string,
+		stdout, stderr io.Writer) error
+}
+
+var commands = map[string]command{
+	"validate": {"validate a JSON document against a JSON schema", runValidate},
+	"merklize": {"merklize a JSON-LD document and print the root and entries", runMerklize},
+	"path":     {"resolve a field path to merklize Path and its key hash", runPath},
+	"claim":    {"build a core claim from a credential", runClaim},
+	"verify":   {"verify a credential proof", runVerify},
+}
+
+func main() {
+	err := run(context.Background(), os.Args[1:], os.Stdout, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		if !errors.Is(err, errFailed) {
+			fmt.Fprintf(os.Stderr, "schemaproc: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" ||
+		args[0] == "help" {
+
+		printUsage(stderr)
+		return flag.ErrHelp
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		printUsage(stderr)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return cmd.run(ctx, args[1:], stdout, stderr)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: schemaproc <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-9s %v\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'schemaproc <command> -h' for command flags.")
+}
+
+func newFlagSet(output io.Writer, name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: schemaproc %v [flags] %v\n\n",
+			name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// readInput reads the file or stdin if name is "-"
+func readInput(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	core "github.com/iden3/go-iden3-core/v2"
+	"github.com/iden3/go-schema-processor/v2/loaders"
+	tst "github.com/iden3/go-schema-processor/v2/testing"
+	"github.com/iden3/go-schema-processor/v2/verifiable"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	bundleDir      = "../../merklize/testdata/httpresp"
+	credentialFile = "testdata/credential-kyc-age.json"
+	resolverURL    = "http://my-universal-resolver/1.0/identifiers"
+)
+
+func runCmd(t testing.TB, args ...string) (map[string]any, error) {
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), args, &stdout, &stderr)
+	if stdout.Len() == 0 {
+		return nil, err
+	}
+	var out map[string]any
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &out))
+	return out, err
+}
+
+func credentialProofClaim(t testing.TB,
+	proofType verifiable.ProofType) *core.Claim {
+
+	credBytes, err := os.ReadFile(credentialFile)
+	require.NoError(t, err)
+	var cred verifiable.W3CCredential
+	require.NoError(t, json.Unmarshal(credBytes, &cred))
+	claim, err := cred.GetCoreClaimFromProof(proofType)
+	require.NoError(t, err)
+	return claim
+}
+
+func TestValidate(t *testing.T) {
+	out, err := runCmd(t, "validate", "-schema", "testdata/schema.json",
+		"testdata/document.json")
+	require.ErrorIs(t, err, errFailed)
+	require.Equal(t, map[string]any{
+		"valid": false,
+		"violations": []any{
+			map[string]any{
+				"instanceLocation": "/documentType",
+				"keyword":          "maximum",
+				"keywordLocation":  "/properties/documentType/maximum",
+				"schemaLocation":   "#/properties/documentType/maximum",
+				"message":          "must be <= 1 but found 2",
+			},
+		},
+	}, out)
+
+	out, err = runCmd(t, "validate", "-schema",
+		"../../processor/json/testdata/schema.json", "testdata/document.json")
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"valid": true}, out)
+
+	_, err = runCmd(t, "validate", "testdata/document.json")
+	require.EqualError(t, err, "document and -schema are required")
+}
+
+func TestMerklize(t *testing.T) {
+	// merklized root of the claim is calculated without proofs
+	credBytes, err := os.ReadFile(credentialFile)
+	require.NoError(t, err)
+	var credObj map[string]any
+	require.NoError(t, json.Unmarshal(credBytes, &credObj))
+	delete(credObj, "proof")
+	credBytes, err = json.Marshal(credObj)
+	require.NoError(t, err)
+	docFile := filepath.Join(t.TempDir(), "credential.json")
+	require.NoError(t, os.WriteFile(docFile, credBytes, 0o600))
+
+	out, err := runCmd(t, "merklize", "-offline", "-bundle", bundleDir,
+		docFile)
+	require.NoError(t, err)
+
+	claim := credentialProofClaim(t, verifiable.Iden3SparseMerkleTreeProofType)
+	root, err := claim.GetMerklizedRoot()
+	require.NoError(t, err)
+	require.Equal(t, root.String(), out["root"])
+
+	entries := out["entries"].([]any)
+	require.NotEmpty(t, entries)
+	require.Contains(t, entries, map[string]any{
+		"path": []any{
+			"https://www.w3.org/2018/credentials#credentialSubject",
+			"https://github.com/iden3/claim-schema-vocab/blob/main/credentials/kyc.md#birthday",
+		},
+		"key":      "20376033832371109177683048456014525905119173674985843915445634726167450989630",
+		"value":    "19960424",
+		"rawValue": float64(19960424),
+		"datatype": "http://www.w3.org/2001/XMLSchema#integer",
+	})
+}
+
+func TestPath(t *testing.T) {
+	kycContext := "https://raw.githubusercontent.com/iden3/claim-schema-vocab/main/schemas/json-ld/kyc-v3.json-ld"
+
+	out, err := runCmd(t, "path", "-bundle", bundleDir,
+		"-context", kycContext, "-type", "KYCAgeCredential", "birthday")
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"path": []any{
+			"https://github.com/iden3/claim-schema-vocab/blob/main/credentials/kyc.md#birthday",
+		},
+		"key":      "13957498226090676549077982275691479375806016090569744902205551126070695443543",
+		"datatype": "http://www.w3.org/2001/XMLSchema#integer",
+	}, out)
+
+	out, err = runCmd(t, "path", "-bundle", bundleDir,
+		"-document", credentialFile, "credentialSubject.birthday")
+	require.NoError(t, err)
+	require.Equal(t,
+		"20376033832371109177683048456014525905119173674985843915445634726167450989630",
+		out["key"])
+
+	_, err = runCmd(t, "path", "-context", kycContext, "-document",
+		credentialFile, "birthday")
+	require.EqualError(t, err,
+		"field path and one of -context or -document are required")
+
+	_, err = runCmd(t, "path", "-offline", "-context", kycContext,
+		"-type", "KYCAgeCredential", "birthday")
+	require.EqualError(t, err,
+		"loading document failed: document is not bundled: "+kycContext)
+
+	const wrongDigest = "sha256-RBNvo1WzZ4oRRq0W9+hknpT7T8If536DEMBg9hyq/4o="
+	_, err = runCmd(t, "path", "-offline", "-bundle", bundleDir,
+		"-pin", kycContext+"="+wrongDigest,
+		"-context", kycContext, "-type", "KYCAgeCredential", "birthday")
+	var mismatchErr *loaders.DigestMismatchError
+	require.ErrorAs(t, err, &mismatchErr)
+	require.Equal(t, wrongDigest, mismatchErr.Expected)
+
+	kycFile, err := filepath.Abs(filepath.Join(bundleDir, "kyc-v3.json-ld"))
+	require.NoError(t, err)
+	out, err = runCmd(t, "path", "-file-root", bundleDir,
+		"-context", "file://"+filepath.ToSlash(kycFile),
+		"-type", "KYCAgeCredential", "birthday")
+	require.NoError(t, err)
+	require.Equal(t,
+		"13957498226090676549077982275691479375806016090569744902205551126070695443543",
+		out["key"])
+
+	out, err = runCmd(t, "path", "-file-root", bundleDir,
+		"-rewrite", "https://example.com/="+
+			"file://"+filepath.ToSlash(filepath.Dir(kycFile))+"/",
+		"-context", "https://example.com/kyc-v3.json-ld",
+		"-type", "KYCAgeCredential", "birthday")
+	require.NoError(t, err)
+	require.Equal(t,
+		"13957498226090676549077982275691479375806016090569744902205551126070695443543",
+		out["key"])
+
+	_, err = runCmd(t, "path", "-rewrite", "https://example.com/",
+		"-context", kycContext, "-type", "KYCAgeCredential", "birthday")
+	require.EqualError(t, err, `invalid -rewrite value `+
+		`"https://example.com/", want prefix=replacement`)
+
+	_, err = runCmd(t, "path", "-pin", kycContext, "-context", kycContext,
+		"-type", "KYCAgeCredential", "birthday")
+	require.EqualError(t, err,
+		`invalid -pin value "`+kycContext+`", want url=digest`)
+}
+
+func TestClaim(t *testing.T) {
+	claim := credentialProofClaim(t, verifiable.Iden3SparseMerkleTreeProofType)
+	wantHex, err := claim.Hex()
+	require.NoError(t, err)
+
+	out, err := runCmd(t, "claim", "-bundle", bundleDir,
+		"-rev-nonce", "74881362", "-merklized-root-position", "index",
+		credentialFile)
+	require.NoError(t, err)
+	require.Equal(t, wantHex, out["hex"])
+	require.Len(t, out["slots"], 8)
+}
+
+func TestVerify(t *testing.T) {
+	defer tst.MockHTTPClient(t, map[string]string{
+		"http://my-universal-resolver/1.0/identifiers/did%3Apolygonid%3Apolygon%3Amumbai%3A2qLGnFZiHrhdNh5KwdkGvbCN1sR2pUaBpBahAXC3zf?state=34824a8e1defc326f935044e32e9f513377dbfc031d79475a0190830554d4409": "../../verifiable/testdata/verifycred/my-universal-resolver-3.json",
+	})()
+
+	out, err := runCmd(t, "verify", "-bundle", bundleDir,
+		"-proof-type", "Iden3SparseMerkleTreeProof",
+		"-resolver-url", resolverURL, credentialFile)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"valid":     true,
+		"proofType": "Iden3SparseMerkleTreeProof",
+	}, out)
+
+	out, err = runCmd(t, "verify", "-bundle", bundleDir,
+		"-proof-type", "Iden3SparseMerkleProof",
+		"-resolver-url", resolverURL, credentialFile)
+	require.ErrorIs(t, err, errFailed)
+	require.Equal(t, map[string]any{
+		"valid":     false,
+		"proofType": "Iden3SparseMerkleProof",
+		"error":     "proof not found",
+	}, out)
+}
+
+func TestSplitDocFlag(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "context.jsonld")
+	eqFileName := filepath.Join(dir, "v=2.jsonld")
+	for _, name := range []string{fileName, eqFileName} {
+		require.NoError(t, os.WriteFile(name, []byte("{}"), 0o600))
+	}
+
+	for _, tc := range []struct{ u, fileName string }{
+		{"https://example.com/context.jsonld", fileName},
+		{"https://example.com/context?v=1", fileName},
+		{"https://example.com/context?v=1&t=2", eqFileName},
+	} {
+		u, name, err := splitDocFlag(tc.u + "=" + tc.fileName)
+		require.NoError(t, err)
+		require.Equal(t, tc.u, u)
+		require.Equal(t, tc.fileName, name)
+	}
+
+	for _, d := range []string{"https://example.com/context.jsonld",
+		"https://example.com/context.jsonld=" + dir, "=" + fileName} {
+
+		_, _, err := splitDocFlag(d)
+		require.EqualError(t, err, "invalid -doc value \""+d+
+			"\", want url=file with existing file")
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	_, err := runCmd(t, "sign")
+	require.EqualError(t, err, `unknown command "sign"`)
+}
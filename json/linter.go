@@ -0,0 +1,372 @@
+package json
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/iden3/go-schema-processor/v2/loaders"
+	"github.com/iden3/go-schema-processor/v2/merklize"
+	"github.com/iden3/go-schema-processor/v2/processor"
+	"github.com/iden3/go-schema-processor/v2/verifiable"
+	"github.com/piprate/json-gold/ld"
+	"github.com/pkg/errors"
+)
+
+const credentialSubjectLocation = "#/properties/credentialSubject"
+
+var errLoaderNotDefined = errors.New("loader is not defined")
+
+// SchemaIssue describes a mismatch between the JSON schema and the JSON-LD
+// context of the credential type
+type SchemaIssue struct {
+	// Field is the path of the field inside credentialSubject, e.g.
+	// postalProviderInformation.insured
+	Field string `json:"field"`
+	// SchemaLocation is the location of the field definition in the JSON
+	// schema, e.g. #/properties/credentialSubject/properties/birthday
+	SchemaLocation string `json:"schemaLocation"`
+	// Message is a human-readable description of the mismatch
+	Message string `json:"message"`
+}
+
+func (i SchemaIssue) String() string {
+	return fmt.Sprintf("%v (%v): %v", i.Field, i.SchemaLocation, i.Message)
+}
+
+// Linter checks that the JSON schema of the credential is consistent with
+// the JSON-LD context it refers to
+type Linter struct {
+	documentLoader ld.DocumentLoader
+}
+
+// NewLinter creates a Linter that loads schemas and contexts with the
+// document loader
+func NewLinter(documentLoader ld.DocumentLoader) Linter {
+	return Linter{documentLoader: documentLoader}
+}
+
+// Lint loads the JSON schema by URL and the JSON-LD context referenced by
+// $metadata.uris.jsonLdContext, and checks the credential type from
+// $metadata.type. See LintDocuments for the list of checks.
+func (l Linter) Lint(ctx context.Context,
+	schemaURL string) ([]SchemaIssue, error) {
+
+	if l.documentLoader == nil {
+		return nil, errLoaderNotDefined
+	}
+	l.documentLoader = loaders.BindContext(ctx, l.documentLoader)
+
+	schemaBytes, err := l.loadDocument(schemaURL)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "can't load schema %v",
+			schemaURL)
+	}
+
+	md, err := processor.ParseSchemaMetadata(schemaBytes)
+	if err != nil {
+		return nil, err
+	}
+	ctxURL := md.URIs.JSONLDContext
+	if ctxURL == "" {
+		return nil, errors.New("schema has no $metadata.uris.jsonLdContext")
+	}
+	if md.Type == "" {
+		return nil, errors.New("schema has no $metadata.type")
+	}
+
+	ctxBytes, err := l.loadDocument(ctxURL)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "can't load context %v", ctxURL)
+	}
+
+	return l.LintDocuments(schemaBytes, ctxBytes, md.Type)
+}
+
+// LintDocuments checks the JSON schema against the JSON-LD context of the
+// type and returns all mismatches found. Type may be given either by name
+// or by id, as in the verifiable package. The error is returned only if
+// documents can't be parsed. It reports:
+//   - credentialSubject properties that are not defined in the context and
+//     would be silently dropped on merklization;
+//   - XSD @type of the term that contradicts the JSON schema type, e.g. a
+//     string field mapped to xsd:integer;
+//   - fields from iden3_serialization attribute that are missing in the
+//     schema or in the context, or can't be serialized to a field element.
+func (l Linter) LintDocuments(schema, ldContext []byte,
+	typeName string) ([]SchemaIssue, error) {
+
+	var schemaDoc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(schema))
+	dec.UseNumber()
+	err := dec.Decode(&schemaDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	subjectSchema, ok := objectProperties(schemaDoc)["credentialSubject"].(map[string]any)
+	if !ok {
+		return nil, errors.New("schema has no credentialSubject property")
+	}
+
+	var ctxDoc map[string]any
+	err = json.Unmarshal(ldContext, &ctxDoc)
+	if err != nil {
+		return nil, err
+	}
+	ctxObj, ok := ctxDoc[contextFullKey]
+	if !ok {
+		return nil, errors.New("document has no @context")
+	}
+
+	opts := ld.NewJsonLdOptions("")
+	if l.documentLoader != nil {
+		opts.DocumentLoader = l.documentLoader
+	}
+	ldCtx, err := ld.NewContext(nil, opts).Parse(ctxObj)
+	if err != nil {
+		return nil, err
+	}
+
+	typeCtx, err := verifiable.TypeContextFromParsedContext(ldCtx, typeName)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []SchemaIssue
+	lintProperties(typeCtx, subjectSchema, "", credentialSubjectLocation,
+		&issues)
+
+	serAttr, err := verifiable.GetSerializationAttrFromParsedContext(ldCtx,
+		typeName)
+	if err != nil {
+		return nil, err
+	}
+	if serAttr != "" {
+		sPaths, err := verifiable.ParseSerializationAttr(serAttr)
+		if err != nil {
+			return nil, err
+		}
+		for _, slot := range sPaths.Slots() {
+			lintSlot(typeCtx, subjectSchema, slot, &issues)
+		}
+	}
+
+	return issues, nil
+}
+
+func (l Linter) loadDocument(u string) ([]byte, error) {
+	doc, err := l.documentLoader.LoadDocument(u)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc.Document)
+}
+
+// lintProperties checks properties of the object schema against the terms of
+// the context
+func lintProperties(ldCtx *ld.Context, objSchema map[string]any,
+	fieldPrefix, location string, issues *[]SchemaIssue) {
+
+	props := objectProperties(objSchema)
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// id and type are aliases of @id and @type in credentials context
+		if name == "id" || name == "type" || strings.HasPrefix(name, "@") {
+			continue
+		}
+
+		field := fieldPrefix + name
+		propLocation := location + "/properties/" + escapeJSONPointer(name)
+		propSchema, ok := props[name].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		addIssue := func(format string, args ...any) {
+			*issues = append(*issues, SchemaIssue{
+				Field:          field,
+				SchemaLocation: propLocation,
+				Message:        fmt.Sprintf(format, args...),
+			})
+		}
+
+		termDef := ldCtx.GetTermDefinition(name)
+		if termDef == nil {
+			iri, err := ldCtx.ExpandIri(name, false, true, nil, nil)
+			if err != nil || !ld.IsAbsoluteIri(iri) {
+				addIssue("field is not defined in JSON-LD context")
+			}
+			continue
+		}
+
+		jsonType, itemsSchema := schemaType(propSchema)
+		if jsonType == "array" && itemsSchema != nil {
+			propSchema = itemsSchema
+			propLocation += "/items"
+			jsonType, _ = schemaType(propSchema)
+		}
+
+		datatype := ldCtx.GetTypeMapping(name)
+		if jsonType != "" && !typesCompatible(jsonType, datatype) {
+			addIssue("JSON schema type %v contradicts JSON-LD type %v",
+				jsonType, datatype)
+			continue
+		}
+
+		if jsonType != "object" {
+			continue
+		}
+		nestedCtx := ldCtx
+		if nestedCtxObj, ok := termDef[contextFullKey]; ok {
+			var err error
+			nestedCtx, err = ldCtx.Parse(nestedCtxObj)
+			if err != nil {
+				addIssue("can't parse scoped context: %v", err)
+				continue
+			}
+		}
+		lintProperties(nestedCtx, propSchema, field+".", propLocation, issues)
+	}
+}
+
+// lintSlot checks that the field serialized to the slot is defined in both
+// documents and its value fits into a field element
+func lintSlot(typeCtx *ld.Context, subjectSchema map[string]any,
+	slot verifiable.SlotLayout, issues *[]SchemaIssue) {
+
+	location := credentialSubjectLocation
+	addIssue := func(format string, args ...any) {
+		*issues = append(*issues, SchemaIssue{
+			Field:          slot.Field,
+			SchemaLocation: location,
+			Message: fmt.Sprintf("%v: ", slot.Slot) +
+				fmt.Sprintf(format, args...),
+		})
+	}
+
+	propSchema := subjectSchema
+	for _, term := range strings.Split(slot.Field, ".") {
+		var ok bool
+		propSchema, ok = objectProperties(propSchema)[term].(map[string]any)
+		if !ok {
+			addIssue("field is not defined in JSON schema")
+			return
+		}
+		location += "/properties/" + escapeJSONPointer(term)
+	}
+
+	ldCtx := typeCtx
+	terms := strings.Split(slot.Field, ".")
+	var termDef map[string]any
+	for i, term := range terms {
+		termDef = ldCtx.GetTermDefinition(term)
+		if termDef == nil {
+			addIssue("field is not defined in JSON-LD context")
+			return
+		}
+		nestedCtxObj, ok := termDef[contextFullKey]
+		if !ok || i == len(terms)-1 {
+			continue
+		}
+		var err error
+		ldCtx, err = ldCtx.Parse(nestedCtxObj)
+		if err != nil {
+			addIssue("can't parse scoped context: %v", err)
+			return
+		}
+	}
+
+	jsonType, _ := schemaType(propSchema)
+	datatype := ldCtx.GetTypeMapping(terms[len(terms)-1])
+	_, hasCtx := termDef[contextFullKey]
+	switch {
+	case jsonType == "object" || jsonType == "array" || hasCtx ||
+		datatype == "@id":
+		addIssue("only scalar values can be serialized to slot")
+		return
+	case jsonType != "integer":
+		return
+	}
+
+	for _, bound := range []string{"minimum", "maximum"} {
+		n, ok := propSchema[bound].(json.Number)
+		if !ok {
+			continue
+		}
+		_, err := merklize.HashValue(datatype, n.String())
+		if err != nil {
+			addIssue("%v %v does not fit into a field element: %v", bound, n,
+				err)
+		}
+	}
+}
+
+// typesCompatible reports if values of JSON schema type can be converted to
+// the XSD datatype on merklization
+func typesCompatible(jsonType, datatype string) bool {
+	switch datatype {
+	case "":
+		return true
+	case "@id":
+		return jsonType == "string"
+	case ld.XSDBoolean:
+		return jsonType == "boolean"
+	case ld.XSDInteger,
+		ld.XSDNS + "positiveInteger",
+		ld.XSDNS + "nonNegativeInteger",
+		ld.XSDNS + "negativeInteger",
+		ld.XSDNS + "nonPositiveInteger":
+		return jsonType == "integer"
+	case ld.XSDDouble, ld.XSDNS + "decimal", ld.XSDNS + "float":
+		return jsonType == "number" || jsonType == "integer"
+	}
+	if strings.HasPrefix(datatype, ld.XSDNS) {
+		return jsonType == "string"
+	}
+	// custom datatypes are not checked
+	return true
+}
+
+// schemaType returns the JSON type of the schema ignoring null and the items
+// schema for arrays. Empty type is returned if the schema has no type or
+// allows several types.
+func schemaType(schema map[string]any) (string, map[string]any) {
+	var tp string
+	switch t := schema["type"].(type) {
+	case string:
+		tp = t
+	case []any:
+		for _, v := range t {
+			s, _ := v.(string)
+			if s == "null" {
+				continue
+			}
+			if tp != "" {
+				return "", nil
+			}
+			tp = s
+		}
+	}
+
+	items, _ := schema["items"].(map[string]any)
+	return tp, items
+}
+
+func objectProperties(schema map[string]any) map[string]any {
+	props, _ := schema["properties"].(map[string]any)
+	return props
+}
+
+func escapeJSONPointer(s string) string {
+	s = strings.ReplaceAll(s, "~", "~0")
+	return strings.ReplaceAll(s, "/", "~1")
+}
@@ -0,0 +1,120 @@
+package json
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/iden3/go-schema-processor/v2/loaders"
+	tst "github.com/iden3/go-schema-processor/v2/testing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinter_Lint(t *testing.T) {
+	ipfsCli := tst.MockIPFSClient{
+		"QmLintSchema":  "testdata/lint/schema.json",
+		"QmLintContext": "testdata/lint/context.jsonld",
+	}
+	linter := NewLinter(loaders.NewDocumentLoader(ipfsCli, ""))
+
+	issues, err := linter.Lint(context.Background(), "ipfs://QmLintSchema")
+	require.NoError(t, err)
+
+	const subjectLoc = "#/properties/credentialSubject"
+	require.Equal(t, []SchemaIssue{
+		{
+			Field:          "address.zip",
+			SchemaLocation: subjectLoc + "/properties/address/properties/zip",
+			Message:        "field is not defined in JSON-LD context",
+		},
+		{
+			Field:          "age",
+			SchemaLocation: subjectLoc + "/properties/age",
+			Message: "JSON schema type string contradicts JSON-LD type " +
+				"http://www.w3.org/2001/XMLSchema#integer",
+		},
+		{
+			Field:          "flag",
+			SchemaLocation: subjectLoc + "/properties/flag",
+			Message: "JSON schema type boolean contradicts JSON-LD type " +
+				"http://www.w3.org/2001/XMLSchema#integer",
+		},
+		{
+			Field:          "missing",
+			SchemaLocation: subjectLoc + "/properties/missing",
+			Message:        "field is not defined in JSON-LD context",
+		},
+		{
+			Field:          "counter",
+			SchemaLocation: subjectLoc + "/properties/counter",
+			Message: "slotIndexA: maximum 1e+80 does not fit into a field " +
+				"element: integer exceeds maximum value: 100000000000000000000000000000000000000000000000000000000000000000000000000000000",
+		},
+		{
+			Field:          "address",
+			SchemaLocation: subjectLoc + "/properties/address",
+			Message:        "slotIndexB: only scalar values can be serialized to slot",
+		},
+		{
+			Field:          "ghost",
+			SchemaLocation: subjectLoc,
+			Message:        "slotValueA: field is not defined in JSON schema",
+		},
+	}, issues)
+}
+
+func TestLinter_LintDocuments(t *testing.T) {
+	ldContext, err := os.ReadFile("testdata/lint/context.jsonld")
+	require.NoError(t, err)
+
+	schema := []byte(`{
+  "properties": {
+    "credentialSubject": {
+      "type": "object",
+      "properties": {
+        "id": {"type": "string"},
+        "name": {"type": "string"},
+        "age": {"type": "integer"},
+        "score": {"type": "integer"},
+        "counter": {"type": "integer", "minimum": 1},
+        "address": {
+          "type": "object",
+          "properties": {"city": {"type": "string"}}
+        }
+      }
+    }
+  }
+}`)
+
+	issues, err := Linter{}.LintDocuments(schema, ldContext, "LintTest")
+	require.NoError(t, err)
+	require.Equal(t, []SchemaIssue{
+		{
+			Field:          "address",
+			SchemaLocation: "#/properties/credentialSubject/properties/address",
+			Message:        "slotIndexB: only scalar values can be serialized to slot",
+		},
+		{
+			Field:          "ghost",
+			SchemaLocation: "#/properties/credentialSubject",
+			Message:        "slotValueA: field is not defined in JSON schema",
+		},
+	}, issues)
+
+	// the type may be given by id, as in verifiable package
+	issuesByID, err := Linter{}.LintDocuments(schema, ldContext,
+		"urn:uuid:0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d#LintTest")
+	require.NoError(t, err)
+	require.Equal(t, issues, issuesByID)
+
+	_, err = Linter{}.LintDocuments(schema, ldContext, "UnknownType")
+	require.EqualError(t, err, "type UnknownType not found in context")
+
+	_, err = Linter{}.LintDocuments([]byte(`{}`), ldContext, "LintTest")
+	require.EqualError(t, err, "schema has no credentialSubject property")
+}
+
+func TestLinter_LintNoLoader(t *testing.T) {
+	_, err := Linter{}.Lint(context.Background(), "ipfs://QmLintSchema")
+	require.EqualError(t, err, "loader is not defined")
+}
@@ -65,17 +65,19 @@ func (s Parser) GetFieldSlotIndex(field string, typeName string,
 		return -1, err
 	}
 
-	switch field {
-	case sPaths.IndexAPath:
-		return 2, nil
-	case sPaths.IndexBPath:
-		return 3, nil
-	case sPaths.ValueAPath:
-		return 6, nil
-	case sPaths.ValueBPath:
-		return 7, nil
-	default:
-		return -1, errors.Errorf(
-			"field `%s` not specified in serialization info", field)
+	for _, slot := range sPaths.Slots() {
+		if slot.Field == field {
+			return slot.SlotIndex, nil
+		}
 	}
+	return -1, errors.Errorf(
+		"field `%s` not specified in serialization info", field)
+}
+
+// GetSlotsLayout returns the layout of all data slots of the type: the field
+// serialized to each slot, its XSD datatype and the slot index
+func (s Parser) GetSlotsLayout(typeName string,
+	schemaBytes []byte) (verifiable.SlotsLayout, error) {
+
+	return verifiable.SlotsLayoutFromContext(schemaBytes, typeName, nil)
 }
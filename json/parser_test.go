@@ -149,3 +149,28 @@ func Test_GetFieldSlotIndex(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 7, slotIndex)
 }
+
+func TestParser_GetSlotsLayout(t *testing.T) {
+	contextBytes, err := os.ReadFile("testdata/schema-delivery-address.json-ld")
+	require.NoError(t, err)
+
+	parser := Parser{}
+
+	layout, err := parser.GetSlotsLayout("DeliverAddressMultiTestForked",
+		contextBytes)
+	require.NoError(t, err)
+	require.Equal(t, []verifiable.SlotLayout{
+		{
+			Slot:      verifiable.SlotIndexA,
+			SlotIndex: 2,
+			Field:     "price",
+			Datatype:  "http://www.w3.org/2001/XMLSchema#double",
+		},
+		{
+			Slot:      verifiable.SlotValueB,
+			SlotIndex: 7,
+			Field:     "postalProviderInformation.insured",
+			Datatype:  "http://www.w3.org/2001/XMLSchema#boolean",
+		},
+	}, layout.Slots)
+}
@@ -2,34 +2,294 @@ package json
 
 import (
 	"bytes"
+	"container/list"
+	"crypto/sha256"
 	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
 
+	"github.com/iden3/go-schema-processor/v2/processor"
+	"github.com/piprate/json-gold/ld"
+	"github.com/pkg/errors"
 	jsonschema "github.com/santhosh-tekuri/jsonschema/v5"
 )
 
+const (
+	schemaResourceURL = "temp.json"
+
+	defaultSchemaCacheSize = 128
+)
+
 // Validator validate json data
+//
+// Zero value of Validator compiles the schema on every call. Use NewValidator
+// to get a validator that caches compiled schemas.
 type Validator struct {
+	cache          *schemaCache
+	concurrency    int
+	documentLoader ld.DocumentLoader
 }
 
-// ValidateData validate JSON data by JSON Schema
+// ValidatorOption is an option for NewValidator
+type ValidatorOption func(v *Validator)
+
+// WithSchemaCacheSize sets the maximum number of compiled schemas kept in
+// the cache. When the cache is full, the least recently used schema is
+// evicted. Size less than 1 disables the cache.
+func WithSchemaCacheSize(size int) ValidatorOption {
+	return func(v *Validator) {
+		if size < 1 {
+			v.cache = nil
+			return
+		}
+		v.cache = newSchemaCache(size)
+	}
+}
+
+// WithBatchConcurrency sets the number of goroutines ValidateBatch uses to
+// validate documents. Values less than 2 validate documents sequentially.
+func WithBatchConcurrency(n int) ValidatorOption {
+	return func(v *Validator) {
+		v.concurrency = n
+	}
+}
+
+// WithDocumentLoader sets the loader used to fetch schemas referenced with
+// $ref, so referenced schemas are loaded the same way as JSON-LD contexts
+// (IPFS, cache, embedded documents). Local file:// references are still read
+// from disk. Without this option references are resolved by jsonschema
+// library itself.
+func WithDocumentLoader(documentLoader ld.DocumentLoader) ValidatorOption {
+	return func(v *Validator) {
+		v.documentLoader = documentLoader
+	}
+}
+
+// NewValidator creates a Validator that caches compiled schemas by the hash
+// of their content.
+func NewValidator(opts ...ValidatorOption) Validator {
+	v := Validator{cache: newSchemaCache(defaultSchemaCacheSize)}
+	for _, o := range opts {
+		o(&v)
+	}
+	return v
+}
+
+// ValidateData validate JSON data by JSON Schema. If data does not conform to
+// the schema, the returned error is *processor.ValidationError.
 func (v Validator) ValidateData(data, schema []byte) error {
+	sh, err := v.compile(schema)
+	if err != nil {
+		return err
+	}
+	return validateDocument(sh, data)
+}
+
+// ValidateBatch validates every document from data against the schema. The
+// schema is compiled only once. The returned slice contains the validation
+// error (or nil) for each document in the same order as data. The error is
+// returned only if the schema itself can't be compiled.
+func (v Validator) ValidateBatch(data [][]byte, schema []byte) ([]error, error) {
+	sh, err := v.compile(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(data))
+	if v.concurrency < 2 || len(data) < 2 {
+		for i := range data {
+			errs[i] = validateDocument(sh, data[i])
+		}
+		return errs, nil
+	}
+
+	workers := v.concurrency
+	if workers > len(data) {
+		workers = len(data)
+	}
+
+	idxCh := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range idxCh {
+				errs[i] = validateDocument(sh, data[i])
+			}
+		}()
+	}
+	for i := range data {
+		idxCh <- i
+	}
+	close(idxCh)
+	wg.Wait()
+
+	return errs, nil
+}
 
+func (v Validator) compile(schema []byte) (*jsonschema.Schema, error) {
+	if v.cache == nil {
+		return v.compileSchema(schema)
+	}
+
+	key := sha256.Sum256(schema)
+	if sh, ok := v.cache.get(key); ok {
+		return sh, nil
+	}
+
+	sh, err := v.compileSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	v.cache.add(key, sh)
+	return sh, nil
+}
+
+func (v Validator) compileSchema(schema []byte) (*jsonschema.Schema, error) {
 	compiler := jsonschema.NewCompiler()
+	if v.documentLoader != nil {
+		compiler.LoadURL = v.loadURL
+	}
 
-	err := compiler.AddResource("temp.json", bytes.NewReader(schema))
+	err := compiler.AddResource(schemaResourceURL, bytes.NewReader(schema))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	return compiler.Compile(schemaResourceURL)
+}
+
+// loadURL loads referenced schema with the document loader.
+func (v Validator) loadURL(s string) (io.ReadCloser, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "file" {
+		return jsonschema.LoadURL(s)
+	}
+
+	doc, err := v.documentLoader.LoadDocument(s)
+	if err != nil {
+		return nil, err
+	}
+
+	docBytes, err := json.Marshal(doc.Document)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(docBytes)), nil
+}
+
+func validateDocument(sh *jsonschema.Schema, data []byte) error {
 	var c map[string]interface{}
-	err = json.Unmarshal(data, &c)
+	err := json.Unmarshal(data, &c)
 	if err != nil {
 		return err
 	}
+	return newValidationError(sh, sh.Validate(c))
+}
 
-	sh, err := compiler.Compile("temp.json")
-	if err != nil {
+// newValidationError converts jsonschema validation error to
+// *processor.ValidationError. Only the leaves of the error tree are reported
+// as violations, intermediate nodes just point to the failed subschemas.
+// Other errors are returned unchanged.
+func newValidationError(sh *jsonschema.Schema, err error) error {
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
 		return err
 	}
-	return sh.Validate(c)
+
+	baseURL := sh.Location
+	if i := strings.IndexByte(baseURL, '#'); i != -1 {
+		baseURL = baseURL[:i]
+	}
+
+	var violations []processor.Violation
+	var collect func(e *jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) != 0 {
+			for _, c := range e.Causes {
+				collect(c)
+			}
+			return
+		}
+
+		var keyword string
+		if i := strings.LastIndexByte(e.KeywordLocation, '/'); i != -1 {
+			keyword = e.KeywordLocation[i+1:]
+		}
+
+		violations = append(violations, processor.Violation{
+			InstanceLocation: e.InstanceLocation,
+			Keyword:          keyword,
+			KeywordLocation:  e.KeywordLocation,
+			SchemaLocation: strings.TrimPrefix(e.AbsoluteKeywordLocation,
+				baseURL),
+			Message: e.Message,
+		})
+	}
+	collect(ve)
+
+	return &processor.ValidationError{Violations: violations}
+}
+
+type schemaCacheEntry struct {
+	key    [sha256.Size]byte
+	schema *jsonschema.Schema
+}
+
+// schemaCache is an LRU cache of compiled schemas
+type schemaCache struct {
+	m       sync.Mutex
+	size    int
+	ll      *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+func newSchemaCache(size int) *schemaCache {
+	return &schemaCache{
+		size:    size,
+		ll:      list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+func (c *schemaCache) get(key [sha256.Size]byte) (*jsonschema.Schema, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*schemaCacheEntry).schema, true
+}
+
+func (c *schemaCache) add(key [sha256.Size]byte, sh *jsonschema.Schema) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*schemaCacheEntry).schema = sh
+		return
+	}
+
+	c.entries[key] = c.ll.PushFront(&schemaCacheEntry{key: key, schema: sh})
+	for c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.entries, oldest.Value.(*schemaCacheEntry).key)
+	}
+}
+
+func (c *schemaCache) len() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.ll.Len()
 }
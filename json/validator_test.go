@@ -1,8 +1,13 @@
 package json
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"testing"
 
+	"github.com/iden3/go-schema-processor/v2/loaders"
+	"github.com/iden3/go-schema-processor/v2/processor"
+	tst "github.com/iden3/go-schema-processor/v2/testing"
 	"github.com/iden3/go-schema-processor/v2/verifiable"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -348,3 +353,184 @@ func TestValidator_ValidateDraft2020(t *testing.T) {
 	err := v.ValidateData([]byte(cred20), []byte(schema2020))
 	require.NoError(t, err)
 }
+
+func TestValidator_SchemaCache(t *testing.T) {
+	v := NewValidator(WithSchemaCacheSize(1))
+
+	err := v.ValidateData([]byte(cred07), []byte(schema07))
+	require.NoError(t, err)
+	require.Equal(t, 1, v.cache.len())
+
+	// same schema should be taken from the cache
+	sh, ok := v.cache.get(sha256.Sum256([]byte(schema07)))
+	require.True(t, ok)
+	err = v.ValidateData([]byte(cred07), []byte(schema07))
+	require.NoError(t, err)
+	sh2, ok := v.cache.get(sha256.Sum256([]byte(schema07)))
+	require.True(t, ok)
+	require.Same(t, sh, sh2)
+
+	// new schema evicts the previous one
+	err = v.ValidateData([]byte(cred20), []byte(schema2020))
+	require.NoError(t, err)
+	require.Equal(t, 1, v.cache.len())
+	_, ok = v.cache.get(sha256.Sum256([]byte(schema07)))
+	require.False(t, ok)
+	_, ok = v.cache.get(sha256.Sum256([]byte(schema2020)))
+	require.True(t, ok)
+}
+
+func TestValidator_ValidateBatch(t *testing.T) {
+	noIDDocument := `{"service":[]}`
+	validDocument := `{"id":"did:example:123"}`
+
+	data := [][]byte{
+		[]byte(validDocument),
+		[]byte(noIDDocument),
+		[]byte(validDocument),
+		[]byte(`not a json`),
+	}
+
+	for _, v := range []Validator{
+		{},
+		NewValidator(),
+		NewValidator(WithBatchConcurrency(3)),
+	} {
+		errs, err := v.ValidateBatch(data,
+			[]byte(verifiable.DIDDocumentJSONSchema))
+		require.NoError(t, err)
+		require.Len(t, errs, len(data))
+		require.NoError(t, errs[0])
+		require.ErrorContains(t, errs[1], "missing properties: 'id'")
+		require.NoError(t, errs[2])
+		require.Error(t, errs[3])
+	}
+}
+
+func TestValidator_ValidateBatchInvalidSchema(t *testing.T) {
+	v := NewValidator()
+	_, err := v.ValidateBatch([][]byte{[]byte(`{}`)}, []byte(`{"type": 1}`))
+	require.Error(t, err)
+	require.Equal(t, 0, v.cache.len())
+}
+
+func TestValidator_ValidationError(t *testing.T) {
+	jsonDIDDocument := `{"service":[{"id":"did:example:123#linked-domain","serviceEndpoint":"https://bar.example.com"}],"alsoKnownAs":[1]}`
+
+	v := Validator{}
+	err := v.ValidateData([]byte(jsonDIDDocument),
+		[]byte(verifiable.DIDDocumentJSONSchema))
+
+	var validationErr *processor.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.ElementsMatch(t, []processor.Violation{
+		{
+			InstanceLocation: "",
+			Keyword:          "required",
+			KeywordLocation:  "/required",
+			SchemaLocation:   "#/required",
+			Message:          "missing properties: 'id'",
+		},
+		{
+			InstanceLocation: "/service/0",
+			Keyword:          "required",
+			KeywordLocation:  "/properties/service/items/$ref/required",
+			SchemaLocation:   "#/$defs/serviceEndpoint/required",
+			Message:          "missing properties: 'type'",
+		},
+		{
+			InstanceLocation: "/alsoKnownAs/0",
+			Keyword:          "type",
+			KeywordLocation:  "/properties/alsoKnownAs/items/type",
+			SchemaLocation:   "#/properties/alsoKnownAs/items/type",
+			Message:          "expected string, but got number",
+		},
+	}, validationErr.Violations)
+}
+
+func TestValidator_ValidationErrorCredentialSubject(t *testing.T) {
+	var cred map[string]any
+	err := json.Unmarshal([]byte(cred20), &cred)
+	require.NoError(t, err)
+	cred["credentialSubject"].(map[string]any)["integer"] = "1"
+	credBytes, err := json.Marshal(cred)
+	require.NoError(t, err)
+
+	v := NewValidator()
+	err = v.ValidateData(credBytes, []byte(schema2020))
+	var validationErr *processor.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Len(t, validationErr.Violations, 1)
+	require.Equal(t, "/credentialSubject/integer",
+		validationErr.Violations[0].InstanceLocation)
+	require.Equal(t, "type", validationErr.Violations[0].Keyword)
+	require.EqualError(t, err, "data validation failed: "+
+		"'#/credentialSubject/integer': expected integer, but got string")
+}
+
+func TestValidator_RemoteRefs(t *testing.T) {
+	defer tst.MockHTTPClient(t, map[string]string{
+		"https://example.com/definitions.json": "testdata/refs/definitions.json",
+	})()
+
+	ipfsCli := tst.MockIPFSClient{
+		"QmWVYqRNXNRaBmzZYSupMJUW3ZdHB4BVwgVfkRWm1Qhgdq/definitions.json": "testdata/refs/definitions.json",
+	}
+	loader := loaders.NewDocumentLoader(ipfsCli, "")
+
+	schema := []byte(`{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "properties": {
+    "birthday": {
+      "$ref": "ipfs://QmWVYqRNXNRaBmzZYSupMJUW3ZdHB4BVwgVfkRWm1Qhgdq/definitions.json#/$defs/birthday"
+    },
+    "documentType": {
+      "$ref": "https://example.com/definitions.json#/$defs/documentType"
+    }
+  },
+  "required": ["birthday", "documentType"]
+}`)
+
+	v := NewValidator(WithDocumentLoader(loader))
+
+	err := v.ValidateData([]byte(`{"birthday": 19960424, "documentType": 2}`),
+		schema)
+	require.NoError(t, err)
+
+	err = v.ValidateData([]byte(`{"birthday": 1, "documentType": 5}`),
+		schema)
+	var validationErr *processor.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.ElementsMatch(t, []processor.Violation{
+		{
+			InstanceLocation: "/birthday",
+			Keyword:          "minimum",
+			KeywordLocation:  "/properties/birthday/$ref/minimum",
+			SchemaLocation:   "ipfs://QmWVYqRNXNRaBmzZYSupMJUW3ZdHB4BVwgVfkRWm1Qhgdq/definitions.json#/$defs/birthday/minimum",
+			Message:          "must be >= 1.9000101e+07 but found 1",
+		},
+		{
+			InstanceLocation: "/documentType",
+			Keyword:          "enum",
+			KeywordLocation:  "/properties/documentType/$ref/enum",
+			SchemaLocation:   "https://example.com/definitions.json#/$defs/documentType/enum",
+			Message:          `value must be one of "1", "2", "3"`,
+		},
+	}, validationErr.Violations)
+}
+
+func TestValidator_RemoteRefsNotFound(t *testing.T) {
+	loader := loaders.NewDocumentLoader(tst.MockIPFSClient{}, "")
+	v := NewValidator(WithDocumentLoader(loader))
+
+	schema := []byte(`{
+  "properties": {
+    "birthday": {
+      "$ref": "ipfs://QmWVYqRNXNRaBmzZYSupMJUW3ZdHB4BVwgVfkRWm1Qhgdq#/$defs/birthday"
+    }
+  }
+}`)
+	err := v.ValidateData([]byte(`{"birthday": 19960424}`), schema)
+	require.ErrorContains(t, err, "not found")
+}
@@ -0,0 +1,164 @@
+package loaders
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/piprate/json-gold/ld"
+)
+
+// BundleManifestFile is the name of the bundle manifest. The manifest is a
+// JSON object that maps document URLs to file paths relative to the bundle
+// root, e.g.
+//
+//	{
+//	  "https://www.w3.org/2018/credentials/v1": "credentials-v1.jsonld",
+//	  "ipfs://QmdH1Vu79p2NcZLFbHxzJnLuUHJiMZnBeT7SNpLaqK7k9X": "kyc.json"
+//	}
+const BundleManifestFile = "manifest.json"
+
+// ErrDocumentNotBundled is returned in offline mode for documents that are
+// neither bundled nor cached
+var ErrDocumentNotBundled = errors.New("document is not bundled")
+
+// Bundle is a set of JSON-LD contexts and JSON schemas that the document
+// loader serves without network access
+type Bundle struct {
+	docs map[string]*ld.RemoteDocument
+}
+
+// URLs returns URLs of bundled documents
+func (b *Bundle) URLs() []string {
+	urls := make([]string, 0, len(b.docs))
+	for u := range b.docs {
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// LoadBundleFS reads the bundle from the file system, e.g. embed.FS. The
+// manifest must be in the root of fsys.
+func LoadBundleFS(fsys fs.FS) (*Bundle, error) {
+	return newBundle(func(name string) ([]byte, error) {
+		return fs.ReadFile(fsys, name)
+	})
+}
+
+// LoadBundleDir reads the bundle from the directory with the manifest
+func LoadBundleDir(dir string) (*Bundle, error) {
+	return LoadBundleFS(os.DirFS(dir))
+}
+
+// LoadBundleTar reads the bundle from the tar archive, optionally compressed
+// with gzip. The manifest must be in the root of the archive.
+func LoadBundleTar(r io.Reader) (*Bundle, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	var tr *tar.Reader
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = gr.Close() }()
+		tr = tar.NewReader(gr)
+	} else {
+		tr = tar.NewReader(br)
+	}
+
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(strings.TrimPrefix(hdr.Name, "./"))] = data
+	}
+
+	return newBundle(func(name string) ([]byte, error) {
+		data, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("file %v not found in tar: %w", name,
+				fs.ErrNotExist)
+		}
+		return data, nil
+	})
+}
+
+func newBundle(readFile func(name string) ([]byte, error)) (*Bundle, error) {
+	manifestBytes, err := readFile(BundleManifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("can't read bundle manifest: %w", err)
+	}
+	var manifest map[string]string
+	err = json.Unmarshal(manifestBytes, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle manifest: %w", err)
+	}
+
+	b := &Bundle{docs: make(map[string]*ld.RemoteDocument, len(manifest))}
+	for u, name := range manifest {
+		name = path.Clean(strings.TrimPrefix(name, "./"))
+		if !fs.ValidPath(name) {
+			return nil, fmt.Errorf("invalid path of bundled document %v: %v",
+				u, name)
+		}
+		docBytes, err := readFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("can't read bundled document %v: %w", u,
+				err)
+		}
+		doc := &ld.RemoteDocument{DocumentURL: u}
+		err = json.Unmarshal(docBytes, &doc.Document)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundled document %v: %w", u, err)
+		}
+		b.docs[u] = doc
+	}
+	return b, nil
+}
+
+// WithBundle makes the loader serve documents from the bundle before looking
+// into the cache or the network. The option may be used several times,
+// documents from later bundles take precedence.
+func WithBundle(b *Bundle) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		if loader.bundle == nil {
+			loader.bundle = make(map[string]*ld.RemoteDocument, len(b.docs))
+		}
+		for u, doc := range b.docs {
+			loader.bundle[u] = doc
+		}
+	}
+}
+
+// WithOfflineMode forbids the loader to make any network or IPFS requests.
+// Only bundled and cached documents are loaded, for other URLs the error
+// wrapping ErrDocumentNotBundled is returned.
+func WithOfflineMode() DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.offline = true
+	}
+}
@@ -0,0 +1,216 @@
+package loaders
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testBundleDir = "../merklize/testdata/httpresp"
+
+var testBundleURLs = []string{
+	"https://raw.githubusercontent.com/iden3/claim-schema-vocab/main/schemas/json-ld/kyc-v3.json-ld",
+	"https://schema.iden3.io/core/jsonld/iden3proofs.jsonld",
+	"https://www.w3.org/2018/credentials/v1",
+}
+
+func requireBundle(t testing.TB, b *Bundle) {
+	urls := b.URLs()
+	sort.Strings(urls)
+	require.Equal(t, testBundleURLs, urls)
+
+	loader := NewDocumentLoader(nil, "", WithBundle(b), WithOfflineMode())
+	for _, u := range urls {
+		doc, err := loader.LoadDocument(u)
+		require.NoError(t, err)
+		require.Equal(t, u, doc.DocumentURL)
+		require.NotNil(t, doc.Document)
+	}
+}
+
+// tarBundle packs the test bundle directory into the tar archive
+func tarBundle(t testing.TB, compress bool) []byte {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gw *gzip.Writer
+	if compress {
+		gw = gzip.NewWriter(&buf)
+		w = gw
+	}
+	tw := tar.NewWriter(w)
+
+	err := fs.WalkDir(os.DirFS(testBundleDir), ".",
+		func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			data, err := os.ReadFile(testBundleDir + "/" + name)
+			if err != nil {
+				return err
+			}
+			err = tw.WriteHeader(&tar.Header{Name: "./" + name,
+				Mode: 0o644, Size: int64(len(data)),
+				Typeflag: tar.TypeReg})
+			if err != nil {
+				return err
+			}
+			_, err = tw.Write(data)
+			return err
+		})
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	if gw != nil {
+		require.NoError(t, gw.Close())
+	}
+	return buf.Bytes()
+}
+
+func TestLoadBundleDir(t *testing.T) {
+	b, err := LoadBundleDir(testBundleDir)
+	require.NoError(t, err)
+	requireBundle(t, b)
+}
+
+func TestLoadBundleFS(t *testing.T) {
+	b, err := LoadBundleFS(os.DirFS(testBundleDir))
+	require.NoError(t, err)
+	requireBundle(t, b)
+}
+
+func TestLoadBundleTar(t *testing.T) {
+	b, err := LoadBundleTar(bytes.NewReader(tarBundle(t, false)))
+	require.NoError(t, err)
+	requireBundle(t, b)
+
+	b, err = LoadBundleTar(bytes.NewReader(tarBundle(t, true)))
+	require.NoError(t, err)
+	requireBundle(t, b)
+}
+
+func TestLoadBundle_Errors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		fs      fstest.MapFS
+		wantErr string
+	}{
+		{
+			name: "no manifest",
+			fs:   fstest.MapFS{},
+			wantErr: "can't read bundle manifest: open manifest.json: " +
+				"file does not exist",
+		},
+		{
+			name: "invalid manifest",
+			fs: fstest.MapFS{
+				"manifest.json": {Data: []byte(`["a.jsonld"]`)},
+			},
+			wantErr: "invalid bundle manifest: json: cannot unmarshal " +
+				"array into Go value of type map[string]string",
+		},
+		{
+			name: "missing document",
+			fs: fstest.MapFS{
+				"manifest.json": {
+					Data: []byte(`{"https://example.com/a":"a.jsonld"}`)},
+			},
+			wantErr: "can't read bundled document https://example.com/a: " +
+				"open a.jsonld: file does not exist",
+		},
+		{
+			name: "document outside of the bundle",
+			fs: fstest.MapFS{
+				"manifest.json": {
+					Data: []byte(`{"https://example.com/a":"../a.jsonld"}`)},
+			},
+			wantErr: "invalid path of bundled document " +
+				"https://example.com/a: ../a.jsonld",
+		},
+		{
+			name: "invalid document",
+			fs: fstest.MapFS{
+				"manifest.json": {
+					Data: []byte(`{"https://example.com/a":"a.jsonld"}`)},
+				"a.jsonld": {Data: []byte(`{`)},
+			},
+			wantErr: "invalid bundled document https://example.com/a: " +
+				"unexpected end of JSON input",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadBundleFS(tc.fs)
+			require.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestDocumentLoader_OfflineMode(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+
+	b, err := LoadBundleDir(testBundleDir)
+	require.NoError(t, err)
+	ipfsCli := &mockIPFSClient{}
+	loader := NewDocumentLoader(ipfsCli, srv.URL, WithBundle(b),
+		WithOfflineMode())
+
+	u := srv.URL + "/context.jsonld"
+	_, err = loader.LoadDocument(u)
+	require.ErrorIs(t, err, ErrDocumentNotBundled)
+	require.EqualError(t, err,
+		"loading document failed: document is not bundled: "+u)
+
+	const missingIPFSURL = "ipfs://QmTojMfyzxehCJVw7aUrdWuxdF68R7oLYooGHCUr9XLu6T"
+	_, err = loader.LoadDocument(missingIPFSURL)
+	require.ErrorIs(t, err, ErrDocumentNotBundled)
+	require.EqualError(t, err,
+		"loading document failed: document is not bundled: "+missingIPFSURL)
+
+	require.Equal(t, 0, requests)
+	require.Equal(t, 0, ipfsCli.calls)
+
+	// bundled documents are served without offline mode too
+	loader = NewDocumentLoader(nil, "", WithBundle(b))
+	doc, err := loader.LoadDocument(testBundleURLs[0])
+	require.NoError(t, err)
+	require.Equal(t, testBundleURLs[0], doc.DocumentURL)
+}
+
+func TestDocumentLoader_BundledIPFSDocument(t *testing.T) {
+	b, err := LoadBundleFS(fstest.MapFS{
+		BundleManifestFile: {Data: []byte(
+			`{"` + testIPFSURL + `": "contexts/kyc.jsonld"}`)},
+		"contexts/kyc.jsonld": {Data: []byte(testIPFSDoc)},
+	})
+	require.NoError(t, err)
+
+	// the IPFS node has no documents, so they may come only from the bundle
+	ipfsCli := &mockIPFSClient{}
+	for _, opts := range [][]DocumentLoaderOption{
+		{WithBundle(b)},
+		{WithBundle(b), WithOfflineMode()},
+	} {
+		loader := NewDocumentLoader(ipfsCli, "", opts...)
+		doc, err := loader.LoadDocument(testIPFSURL)
+		require.NoError(t, err)
+		require.Equal(t, testIPFSURL, doc.DocumentURL)
+		require.Equal(t, "https://schema.org/name", docContext(t, doc))
+	}
+	require.Equal(t, 0, ipfsCli.calls)
+}
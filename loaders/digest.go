@@ -0,0 +1,146 @@
+package loaders
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/piprate/json-gold/ld"
+)
+
+// DigestMismatchError is returned if the loaded document does not match the
+// digest pinned for its URL
+type DigestMismatchError struct {
+	URL string
+	// Expected is the pinned digest in SRI format
+	Expected string
+	// Actual is the digest of the loaded document computed with the
+	// algorithm of the pinned one
+	Actual string
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("digest of document %v is %v, but %v is pinned",
+		e.URL, e.Actual, e.Expected)
+}
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// DocumentDigest returns the digest of the document in Subresource Integrity
+// format, e.g. "sha256-<base64 hash>". Supported algorithms are sha256,
+// sha384 and sha512. The hash is computed over the canonical JSON encoding
+// of the document: object keys are sorted, there are no insignificant
+// whitespaces and no HTML escaping. So the digest does not depend on the
+// formatting of the hosted document and is the same for cached documents.
+func DocumentDigest(document any, alg string) (string, error) {
+	newHash, ok := digestAlgorithms[alg]
+	if !ok {
+		return "", fmt.Errorf("unsupported digest algorithm: %v", alg)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(document)
+	if err != nil {
+		return "", err
+	}
+
+	h := newHash()
+	h.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return alg + "-" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// WithPinnedDigests makes the loader reject documents that do not match
+// digests pinned for their URLs with DigestMismatchError. pins maps document
+// URLs to digests in the format returned by DocumentDigest. Several
+// space-separated digests may be pinned for a URL, the document must match
+// any of them. Pins from the context passed to LoadDocumentWithContext
+// take precedence.
+func WithPinnedDigests(pins map[string]string) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.pins = mergePins(loader.pins, pins)
+	}
+}
+
+// ErrPinsNotSupported is returned if the document is pinned with
+// ContextWithPinnedDigests, but the loader can't receive the context to
+// verify it
+var ErrPinsNotSupported = errors.New(
+	"document loader does not support pinned digests")
+
+type pinsKey struct{}
+
+// ContextWithPinnedDigests returns the context that pins digests of
+// documents loaded with it, like WithPinnedDigests does for all documents of
+// the loader. It allows to pin documents referenced by a particular
+// credential.
+//
+// Pins are verified by loaders created with NewDocumentLoader. Loaders bound
+// to the context with BindContext that do not implement DocumentLoader
+// fail with ErrPinsNotSupported for pinned documents, and custom
+// DocumentLoader implementations must verify pins themselves, e.g. by
+// delegating to the loader created with NewDocumentLoader.
+func ContextWithPinnedDigests(ctx context.Context,
+	pins map[string]string) context.Context {
+
+	if len(pins) == 0 {
+		return ctx
+	}
+	ctxPins, _ := ctx.Value(pinsKey{}).(map[string]string)
+	return context.WithValue(ctx, pinsKey{}, mergePins(ctxPins, pins))
+}
+
+// mergePins returns the new map, so maps stored in loaders and contexts are
+// never modified
+func mergePins(dst, src map[string]string) map[string]string {
+	m := make(map[string]string, len(dst)+len(src))
+	for u, pin := range dst {
+		m[u] = pin
+	}
+	for u, pin := range src {
+		m[u] = pin
+	}
+	return m
+}
+
+// verifyDigest checks the document against the digest pinned for its URL
+func (d *documentLoader) verifyDigest(ctx context.Context, u string,
+	doc *ld.RemoteDocument) error {
+
+	ctxPins, _ := ctx.Value(pinsKey{}).(map[string]string)
+	pin, ok := ctxPins[u]
+	if !ok {
+		pin, ok = d.pins[u]
+	}
+	if !ok {
+		return nil
+	}
+
+	var actual string
+	for _, expected := range strings.Fields(pin) {
+		alg, _, _ := strings.Cut(expected, "-")
+		var err error
+		actual, err = DocumentDigest(doc.Document, alg)
+		if err != nil {
+			return ld.NewJsonLdError(ld.LoadingDocumentFailed,
+				fmt.Errorf("invalid digest pinned for %v: %w", u, err))
+		}
+		if actual == expected {
+			return nil
+		}
+	}
+	return ld.NewJsonLdError(ld.LoadingDocumentFailed,
+		&DigestMismatchError{URL: u, Expected: pin, Actual: actual})
+}
@@ -0,0 +1,166 @@
+package loaders
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sha256SRI(data string) string {
+	h := sha256.Sum256([]byte(data))
+	return "sha256-" + base64.StdEncoding.EncodeToString(h[:])
+}
+
+func TestDocumentDigest(t *testing.T) {
+	var doc any
+	err := json.Unmarshal([]byte(`{
+		"b": "<tag>&",
+		"a": [1, 2.5, {"d": null, "c": true}]
+	}`), &doc)
+	require.NoError(t, err)
+
+	digest, err := DocumentDigest(doc, "sha256")
+	require.NoError(t, err)
+	require.Equal(t,
+		sha256SRI(`{"a":[1,2.5,{"c":true,"d":null}],"b":"<tag>&"}`), digest)
+
+	digest, err = DocumentDigest(doc, "sha384")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(digest, "sha384-"))
+
+	_, err = DocumentDigest(doc, "md5")
+	require.EqualError(t, err, "unsupported digest algorithm: md5")
+}
+
+func TestDocumentLoader_PinnedDigests(t *testing.T) {
+	ipfsCli := &mockIPFSClient{docs: map[string]string{
+		strings.TrimPrefix(testIPFSURL, "ipfs://"): testIPFSDoc}}
+	digest := sha256SRI(testIPFSDoc)
+	wrongDigest := sha256SRI(`{}`)
+
+	testCases := []struct {
+		name    string
+		pin     string
+		ctxPin  string
+		wantErr bool
+	}{
+		{name: "not pinned"},
+		{name: "match", pin: digest},
+		{name: "mismatch", pin: wrongDigest, wantErr: true},
+		{name: "any of pins", pin: wrongDigest + " " + digest},
+		{name: "context pin", pin: wrongDigest, ctxPin: digest},
+		{name: "context pin mismatch", pin: digest, ctxPin: wrongDigest,
+			wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts []DocumentLoaderOption
+			if tc.pin != "" {
+				opts = append(opts, WithPinnedDigests(
+					map[string]string{testIPFSURL: tc.pin}))
+			}
+			loader := NewDocumentLoader(ipfsCli, "", opts...)
+
+			ctx := context.Background()
+			if tc.ctxPin != "" {
+				ctx = ContextWithPinnedDigests(ctx,
+					map[string]string{testIPFSURL: tc.ctxPin})
+			}
+
+			// the second load comes from the cache and is checked too
+			for i := 0; i < 2; i++ {
+				doc, err := loader.LoadDocumentWithContext(ctx, testIPFSURL)
+				if !tc.wantErr {
+					require.NoError(t, err)
+					require.Equal(t, testIPFSURL, doc.DocumentURL)
+					continue
+				}
+
+				var mismatchErr *DigestMismatchError
+				require.ErrorAs(t, err, &mismatchErr)
+				require.Equal(t, testIPFSURL, mismatchErr.URL)
+				require.Equal(t, digest, mismatchErr.Actual)
+			}
+		})
+	}
+}
+
+func TestDocumentLoader_PinnedDigestsFormatting(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = io.WriteString(w, "{\n  \"@context\": {\n    "+
+				"\"name\": \"https://schema.org/name\"\n  }\n}\n")
+		}))
+	defer srv.Close()
+
+	// the digest does not depend on the formatting of the served document,
+	// so the cached document is verified without loading it again
+	u := srv.URL + "/context.jsonld"
+	loader := NewDocumentLoader(nil, "", WithPinnedDigests(
+		map[string]string{u: sha256SRI(testIPFSDoc)}))
+	for i := 0; i < 2; i++ {
+		_, err := loader.LoadDocument(u)
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestBindContext_PinsNotSupported(t *testing.T) {
+	const u = "https://example.com/context.jsonld"
+	ctx := ContextWithPinnedDigests(context.Background(),
+		map[string]string{u: sha256SRI(`{}`)})
+
+	plainLoader := &countingLoader{}
+	loader := BindContext(ctx, plainLoader)
+	_, err := loader.LoadDocument(u)
+	require.ErrorIs(t, err, ErrPinsNotSupported)
+	_, err = loader.LoadDocument("https://example.com/other.jsonld")
+	require.NoError(t, err)
+	require.Equal(t, 1, plainLoader.calls)
+}
+
+func TestDocumentLoader_PinnedDigestsBundle(t *testing.T) {
+	bundle, err := LoadBundleDir(testBundleDir)
+	require.NoError(t, err)
+
+	const u = "https://www.w3.org/2018/credentials/v1"
+	loader := NewDocumentLoader(nil, "", WithBundle(bundle),
+		WithPinnedDigests(map[string]string{u: sha256SRI(`{}`)}))
+	_, err = loader.LoadDocument(u)
+	var mismatchErr *DigestMismatchError
+	require.ErrorAs(t, err, &mismatchErr)
+}
+
+func TestDocumentLoader_InvalidPinnedDigest(t *testing.T) {
+	ipfsCli := &mockIPFSClient{docs: map[string]string{
+		strings.TrimPrefix(testIPFSURL, "ipfs://"): testIPFSDoc}}
+	loader := NewDocumentLoader(ipfsCli, "", WithPinnedDigests(
+		map[string]string{testIPFSURL: "md5-AAAA"}))
+	_, err := loader.LoadDocument(testIPFSURL)
+	require.EqualError(t, err, "loading document failed: invalid digest "+
+		"pinned for "+testIPFSURL+": unsupported digest algorithm: md5")
+}
+
+func TestContextWithPinnedDigests(t *testing.T) {
+	ctx := ContextWithPinnedDigests(context.Background(),
+		map[string]string{"a": "1", "b": "2"})
+	ctx2 := ContextWithPinnedDigests(ctx, map[string]string{"b": "3"})
+
+	require.Equal(t, map[string]string{"a": "1", "b": "2"},
+		ctx.Value(pinsKey{}))
+	require.Equal(t, map[string]string{"a": "1", "b": "3"},
+		ctx2.Value(pinsKey{}))
+	require.Equal(t, ctx2, ContextWithPinnedDigests(ctx2, nil))
+}
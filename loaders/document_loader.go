@@ -1,27 +1,25 @@
 package loaders
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/piprate/json-gold/ld"
-	"github.com/pquerna/cachecontrol"
 )
 
 const (
-	// An HTTP Accept header that prefers JSONLD.
-	acceptHeader = "application/ld+json, application/json;q=0.9, application/javascript;q=0.5, text/javascript;q=0.5, text/plain;q=0.2, */*;q=0.1"
-
-	// JSON-LD link header rel
-	linkHeaderRel = "http://www.w3.org/ns/json-ld#context"
+	ipfsPrefix = "ipfs://"
 )
 
-var rApplicationJSON = regexp.MustCompile(`^application/(\w*\+)?json$`)
+// noExpireTime is the expire time of cached documents that never change,
+// like IPFS documents addressed by CID
+var noExpireTime = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
 
 var ErrCacheMiss = errors.New("cache miss")
 
@@ -30,16 +28,111 @@ type CacheEngine interface {
 	Set(key string, doc *ld.RemoteDocument, expireTime time.Time) error
 }
 
+// CacheEntry is the cached document with metadata of the HTTP response it
+// was loaded from
+type CacheEntry struct {
+	Document   *ld.RemoteDocument
+	ExpireTime time.Time
+	// ETag and LastModified are validators used to revalidate the expired
+	// document with a conditional request
+	ETag         string
+	LastModified string
+	// StaleUntil is the time until the expired document may still be served
+	// by the loader. Cache engines should not purge the entry before. They
+	// may keep entries with validators after it, so they can be revalidated.
+	StaleUntil time.Time
+}
+
+// EntryCacheEngine is implemented by cache engines that store documents
+// with metadata. Without it the loader can't revalidate expired documents
+// and downloads them again.
+type EntryCacheEngine interface {
+	CacheEngine
+	GetEntry(key string) (CacheEntry, error)
+	SetEntry(key string, entry CacheEntry) error
+}
+
+// ManagedCacheEngine is implemented by cache engines that allow to list and
+// invalidate cached documents, e.g. when a context is republished. Embedded
+// documents are not listed and can't be removed.
+type ManagedCacheEngine interface {
+	CacheEngine
+	// Delete removes the document from the cache. It is not an error if the
+	// document is not cached.
+	Delete(key string) error
+	// Purge removes all documents from the cache
+	Purge() error
+	// Keys returns keys of all cached documents, including expired ones
+	Keys() ([]string, error)
+	// Range calls fn for every cached document until fn returns false. fn
+	// may modify the cache.
+	Range(fn func(key string, entry CacheEntry) bool) error
+}
+
+// DocumentLoader is a JSON-LD document loader that stops loading documents
+// when the context is canceled
+type DocumentLoader interface {
+	ld.DocumentLoader
+	LoadDocumentWithContext(ctx context.Context,
+		u string) (*ld.RemoteDocument, error)
+}
+
+// DocumentRefresher is implemented by document loaders that can reload
+// documents bypassing the cache
+type DocumentRefresher interface {
+	RefreshDocument(ctx context.Context,
+		u string) (*ld.RemoteDocument, error)
+}
+
 type IPFSClient interface {
 	Cat(url string) (io.ReadCloser, error)
 }
 
 type documentLoader struct {
 	ipfsCli     IPFSClient // @formatter:off : Goland bug
-	ipfsGW      string
 	cacheEngine CacheEngine
 	noCache     bool
 	httpClient  *http.Client
+	bundle      map[string]*ld.RemoteDocument
+	offline     bool
+	flights     flightGroup
+
+	staleWhileRevalidate time.Duration
+	staleIfError         time.Duration
+	revalidatingM        sync.Mutex
+	revalidating         map[string]struct{}
+
+	allowedSchemes       []string
+	deniedSchemes        []string
+	allowedHosts         []string
+	deniedHosts          []string
+	blockPrivateNetworks bool
+	maxDocumentSize      int64
+	maxRedirects         int
+	maxAlternateLinks    int
+	requestTimeout       time.Duration
+	// remoteClient fetches untrusted URLs and rewriteClient fetches
+	// rewritten ones, the IPFS gateway is requested with httpClient
+	remoteClient  *http.Client
+	rewriteClient *http.Client
+
+	pins map[string]string
+
+	verifyIPFSGW bool
+	strictIPFSGW bool
+
+	ipfsGateways        ipfsGatewayPool
+	ipfsGatewayFallback bool
+	ipfsRetries         int
+	ipfsBackoff         time.Duration
+	ipfsGatewayReport   func(u, gateway string)
+
+	fileRoot string
+	dataURLs bool
+
+	rewriteRules []urlRewriteRule
+
+	observer LoaderObserver
 }
 
 type DocumentLoaderOption func(*documentLoader)
@@ -61,18 +154,24 @@ func WithHTTPClient(httpClient *http.Client) DocumentLoaderOption {
 	}
 }
 
-// NewDocumentLoader creates a new document loader with a cache for http.
-// ipfs cache is not implemented yet.
+// NewDocumentLoader creates a new document loader with a cache. HTTP documents
+// are cached according to the Cache-Control headers of the response. IPFS
+// documents are cached under their ipfs:// URL without expiration.
 func NewDocumentLoader(ipfsCli IPFSClient, ipfsGW string,
-	opts ...DocumentLoaderOption) ld.DocumentLoader {
+	opts ...DocumentLoaderOption) DocumentLoader {
 	loader := &documentLoader{
-		ipfsCli: ipfsCli,
-		ipfsGW:  ipfsGW,
+		ipfsCli:           ipfsCli,
+		maxRedirects:      defaultMaxRedirects,
+		maxAlternateLinks: defaultMaxAlternateLinks,
 	}
+	loader.ipfsGateways.cooldown = defaultIPFSGatewayCooldown
+	loader.ipfsGateways.add(ipfsGW)
 
 	for _, opt := range opts {
 		opt(loader)
 	}
+	loader.remoteClient = loader.newRemoteClient()
+	loader.rewriteClient = loader.newRewriteClient()
 
 	if loader.cacheEngine == nil && !loader.noCache {
 		// Should not be errors if we call NewMemoryCacheEngine without options
@@ -83,193 +182,342 @@ func NewDocumentLoader(ipfsCli IPFSClient, ipfsGW string,
 }
 
 func (d *documentLoader) LoadDocument(
-	u string) (doc *ld.RemoteDocument, err error) {
+	u string) (*ld.RemoteDocument, error) {
 
-	const ipfsPrefix = "ipfs://"
+	return d.LoadDocumentWithContext(context.Background(), u)
+}
 
-	switch {
-	case strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://"):
-		return d.loadDocumentFromHTTP(u)
-
-	case strings.HasPrefix(u, ipfsPrefix):
-		// supported URLs:
-		// ipfs://<cid>/dir/schema.json
-		// ipfs://<cid>
-
-		doc = &ld.RemoteDocument{DocumentURL: u}
-
-		// strip ipfs:// prefix
-		u = u[len(ipfsPrefix):]
-
-		switch {
-		case d.ipfsCli != nil:
-			doc.Document, err = d.loadDocumentFromIPFSNode(u)
-		case d.ipfsGW != "":
-			doc.Document, err = d.loadDocumentFromIPFSGW(u)
-		default:
-			err = ld.NewJsonLdError(ld.LoadingDocumentFailed,
-				errors.New("ipfs is not configured"))
-		}
+func (d *documentLoader) LoadDocumentWithContext(ctx context.Context,
+	u string) (*ld.RemoteDocument, error) {
+
+	doc, ok := d.bundle[u]
+	if !ok {
+		var err error
+		doc, err = d.flights.do(ctx, u, func() (*ld.RemoteDocument, error) {
+			return d.loadDocument(ctx, u)
+		})
 		if err != nil {
+			d.observeLoadError(u, err)
 			return nil, err
 		}
+	}
+
+	err := d.verifyDigest(ctx, u, doc)
+	if err != nil {
+		d.observeLoadError(u, err)
+		return nil, err
+	}
+	return doc, nil
+}
+
+// RefreshDocument loads the document bypassing the cache, e.g. when the
+// context was republished, and replaces the cached document if the new one
+// may be cached. Otherwise the cached document is removed, or replaced with
+// the expired one if the cache engine does not implement
+// ManagedCacheEngine. The cached document is left intact if loading fails.
+// Bundled and embedded documents are returned as is, without loading.
+func (d *documentLoader) RefreshDocument(ctx context.Context,
+	u string) (*ld.RemoteDocument, error) {
+
+	// concurrent loads are not joined as they may return the cached document
+	ctx = context.WithValue(ctx, refreshKey{}, u)
+	doc, err := d.loadDocument(ctx, u)
+	if err == nil {
+		err = d.verifyDigest(ctx, u, doc)
+	}
+	if err != nil {
+		d.observeLoadError(u, err)
+		return nil, err
+	}
+	return doc, nil
+}
+
+type refreshKey struct{}
+
+// isRefreshing reports if the cached document of u must not be used
+func isRefreshing(ctx context.Context, u string) bool {
+	refreshed, _ := ctx.Value(refreshKey{}).(string)
+	return refreshed == u
+}
 
+// loadDocument loads the document without coalescing with concurrent loads
+// of the same URL
+func (d *documentLoader) loadDocument(ctx context.Context,
+	u string) (*ld.RemoteDocument, error) {
+
+	if doc, ok := d.bundle[u]; ok {
 		return doc, nil
+	}
+
+	if err := d.checkURL(u); err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+
+	// the document is loaded from src, but cached under u
+	src := d.rewriteURL(u)
+
+	switch {
+	case strings.HasPrefix(src, "http://") ||
+		strings.HasPrefix(src, "https://"):
+
+		return d.loadDocumentFromHTTP(ctx, u, src)
+
+	case strings.HasPrefix(src, ipfsPrefix):
+		return d.loadDocumentFromIPFS(ctx, u, src)
+
+	case d.fileRoot != "" && strings.HasPrefix(src, filePrefix):
+		return d.loadDocumentFromFile(ctx, u, src)
+
+	case d.dataURLs && strings.HasPrefix(src, dataPrefix):
+		return d.loadDocumentFromData(ctx, u, src)
 
 	default:
-		err = errors.New("unsupported URL schema")
+		err := errors.New("unsupported URL schema")
 		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
 	}
 }
 
-func (d *documentLoader) loadDocumentFromIPFSNode(
-	ipfsURL string) (document any, err error) {
+// embeddedDocuments is implemented by cache engines with embedded documents
+type embeddedDocuments interface {
+	embeddedEntry(key string) (CacheEntry, bool)
+}
 
-	if d.ipfsCli == nil {
-		return nil, errors.New("ipfs is not configured")
-	}
+// cacheEntry returns the entry from the cache, found is false on cache miss
+// or if the document is refreshed
+func (d *documentLoader) cacheEntry(ctx context.Context,
+	u string) (entry CacheEntry, found bool, err error) {
 
-	var r io.ReadCloser
-	r, err = d.ipfsCli.Cat(ipfsURL)
-	if err != nil {
-		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	if d.cacheEngine == nil {
+		return CacheEntry{}, false, nil
 	}
-	defer func() {
-		err2 := r.Close()
-		if err == nil {
-			err = err2
+	if isRefreshing(ctx, u) {
+		// embedded documents are never replaced, so there is nothing to
+		// refresh
+		if ed, ok := d.cacheEngine.(embeddedDocuments); ok {
+			entry, found = ed.embeddedEntry(u)
 		}
-	}()
+		return entry, found, nil
+	}
 
-	return ld.DocumentFromReader(r)
+	if ec, ok := d.cacheEngine.(EntryCacheEngine); ok {
+		entry, err = ec.GetEntry(u)
+	} else {
+		entry.Document, entry.ExpireTime, err = d.cacheEngine.Get(u)
+	}
+	switch {
+	case errors.Is(err, ErrCacheMiss):
+		return CacheEntry{}, false, nil
+	case err != nil:
+		return CacheEntry{}, false,
+			ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+	return entry, true, nil
 }
 
-func (d *documentLoader) loadDocumentFromIPFSGW(
-	ipfsURL string) (any, error) {
+func (d *documentLoader) setCacheEntry(u string, entry CacheEntry) error {
+	if ec, ok := d.cacheEngine.(EntryCacheEngine); ok {
+		return ec.SetEntry(u, entry)
+	}
+	return d.cacheEngine.Set(u, entry.Document, entry.ExpireTime)
+}
 
-	ipfsURL = strings.TrimRight(d.ipfsGW, "/") + "/ipfs/" +
-		strings.TrimLeft(ipfsURL, "/")
-	doc, err := d.loadDocumentFromHTTP(ipfsURL)
+// cachedDocument returns the document from the cache if it is found and not
+// expired yet. Nil document is returned otherwise.
+func (d *documentLoader) cachedDocument(ctx context.Context,
+	u string) (*ld.RemoteDocument, error) {
+
+	entry, found, err := d.cacheEntry(ctx, u)
 	if err != nil {
 		return nil, err
 	}
-	return doc.Document, nil
+
+	// We need to check if ExpireTime >= now, so we negate the comparison
+	if !found || !entry.ExpireTime.After(time.Now()) {
+		d.observeCache(u, false)
+		return nil, nil
+	}
+	d.observeCache(u, true)
+	return entry.Document, nil
 }
 
-func (d *documentLoader) loadDocumentFromHTTP(
-	u string) (*ld.RemoteDocument, error) {
+func notBundledError(u string) error {
+	return ld.NewJsonLdError(ld.LoadingDocumentFailed,
+		fmt.Errorf("%w: %v", ErrDocumentNotBundled, u))
+}
+
+func (d *documentLoader) loadDocumentFromIPFS(ctx context.Context,
+	u, src string) (*ld.RemoteDocument, error) {
+
+	// supported URLs:
+	// ipfs://<cid>/dir/schema.json
+	// ipfs://<cid>
+
+	doc, err := d.cachedDocument(ctx, u)
+	if err != nil || doc != nil {
+		return doc, err
+	}
+	if d.offline {
+		return nil, notBundledError(u)
+	}
 
-	var doc *ld.RemoteDocument
-	var cacheFound bool
-	var err error
+	doc = &ld.RemoteDocument{DocumentURL: u}
 
-	// We use shouldCache, and expireTime at the end of this method to create
-	// an object to store in the cache. Set them to sane default values now
-	shouldCache := false
-	var expireTime time.Time
+	// strip ipfs:// prefix
+	ipfsURL := src[len(ipfsPrefix):]
+
+	var gateway string
+	switch {
+	case d.ipfsCli != nil:
+		doc.Document, err = d.loadDocumentFromIPFSNode(ctx, ipfsURL)
+		if err != nil && d.ipfsGatewayFallback && !d.ipfsGateways.empty() &&
+			ctx.Err() == nil {
+
+			doc.Document, gateway, err = d.loadDocumentFromIPFSGateways(ctx,
+				ipfsURL)
+		}
+	case !d.ipfsGateways.empty():
+		doc.Document, gateway, err = d.loadDocumentFromIPFSGateways(ctx,
+			ipfsURL)
+	default:
+		err = ld.NewJsonLdError(ld.LoadingDocumentFailed,
+			errors.New("ipfs is not configured"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d.ipfsGatewayReport != nil {
+		d.ipfsGatewayReport(u, gateway)
+	}
 
+	// the content addressed by CID never changes, so there is no need to
+	// ever reload it
 	if d.cacheEngine != nil {
-		doc, expireTime, err = d.cacheEngine.Get(u)
-		switch {
-		case errors.Is(err, ErrCacheMiss):
-			cacheFound = false
-		case err != nil:
+		err = d.cacheEngine.Set(u, doc, noExpireTime)
+		if err != nil {
 			return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
-		default:
-			cacheFound = true
 		}
 	}
 
-	now := time.Now()
+	return doc, nil
+}
 
-	// First we check if we hit in the cache, and the cache entry is valid
-	// We need to check if ExpireTime >= now, so we negate the comparison below
-	if cacheFound && expireTime.After(now) {
-		return doc, nil
+func (d *documentLoader) loadDocumentFromIPFSNode(ctx context.Context,
+	ipfsURL string) (any, error) {
+
+	if d.ipfsCli == nil {
+		return nil, errors.New("ipfs is not configured")
 	}
 
-	req, err := http.NewRequest("GET", u, http.NoBody)
-	if err != nil {
+	ctx, cancel := d.withRequestTimeout(ctx)
+	defer cancel()
+
+	if ctx.Done() == nil {
+		return d.catIPFS(ipfsURL)
+	}
+	if err := ctx.Err(); err != nil {
 		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
 	}
-	// We prefer application/ld+json, but fallback to application/json
-	// or whatever is available
-	req.Header.Add("Accept", acceptHeader)
 
-	httpClient := d.httpClient
-	if httpClient == nil {
-		httpClient = http.DefaultClient
+	// IPFSClient does not accept the context, so we stop waiting for the
+	// result on cancellation and let the request finish in background
+	type catResult struct {
+		document any
+		err      error
 	}
+	resCh := make(chan catResult, 1)
+	go func() {
+		document, err := d.catIPFS(ipfsURL)
+		resCh <- catResult{document, err}
+	}()
 
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	select {
+	case <-ctx.Done():
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, ctx.Err())
+	case res := <-resCh:
+		return res.document, res.err
 	}
-	defer func() { _ = res.Body.Close() }()
+}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed,
-			fmt.Sprintf("Bad response status code: %d",
-				res.StatusCode))
+func (d *documentLoader) catIPFS(ipfsURL string) (document any, err error) {
+	body := &countingReader{}
+	obs := d.startFetch(FetchSourceIPFSNode, ipfsURL)
+	defer func() { obs.finish(0, body.n, err) }()
+
+	var r io.ReadCloser
+	r, err = d.ipfsCli.Cat(ipfsURL)
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
 	}
+	defer func() {
+		err2 := r.Close()
+		if err == nil {
+			err = err2
+		}
+	}()
 
-	doc = &ld.RemoteDocument{DocumentURL: res.Request.URL.String()}
+	body.r = r
+	return d.readDocument(body)
+}
 
-	contentType := res.Header.Get("Content-Type")
-	linkHeader := res.Header.Get("Link")
+func (d *documentLoader) loadDocumentFromIPFSGW(ctx context.Context,
+	gw, ipfsURL string) (any, error) {
 
-	if len(linkHeader) > 0 {
-		parsedLinkHeader := ld.ParseLinkHeader(linkHeader)
-		contextLink := parsedLinkHeader[linkHeaderRel]
-		if contextLink != nil && contentType != ld.ApplicationJSONLDType {
-			if len(contextLink) > 1 {
-				return nil, ld.NewJsonLdError(ld.MultipleContextLinkHeaders,
-					nil)
-			} else if len(contextLink) == 1 {
-				doc.ContextURL = contextLink[0]["target"]
-			}
-		}
+	if d.verifyIPFSGW {
+		document, err := d.loadVerifiedDocumentFromIPFSGW(ctx, gw, ipfsURL)
+		if d.strictIPFSGW ||
+			!errors.Is(err, ErrIPFSDocumentUnverifiable) {
 
-		// If content-type is not application/ld+json, nor any other +json
-		// and a link with rel=alternate and type='application/ld+json' is found,
-		// use that instead
-		alternateLink := parsedLinkHeader["alternate"]
-		if len(alternateLink) > 0 &&
-			alternateLink[0]["type"] == ld.ApplicationJSONLDType &&
-			!rApplicationJSON.MatchString(contentType) {
-
-			finalURL := ld.Resolve(u, alternateLink[0]["target"])
-			doc, err = d.LoadDocument(finalURL)
-			if err != nil {
-				return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
-			}
+			return document, err
 		}
 	}
 
-	reasons, resExpireTime, err := cachecontrol.CachableResponse(req, res,
-		cachecontrol.Options{})
-	// If there are no errors parsing cache headers and there are no
-	// reasons not to cache, then we cache
-	if err == nil && len(reasons) == 0 {
-		shouldCache = true
-		expireTime = resExpireTime
+	// the document is cached by the ipfs:// URL, not by the gateway one
+	res, err := d.fetchDocumentFromHTTP(ctx, d.httpClient,
+		FetchSourceIPFSGateway, ipfsGatewayURL(gw, ipfsURL), nil)
+	if err != nil {
+		return nil, err
 	}
+	return res.entry.Document.Document, nil
+}
 
-	if doc.Document == nil {
-		doc.Document, err = ld.DocumentFromReader(res.Body)
-		if err != nil {
-			return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
-		}
-	}
+func ipfsGatewayURL(gw, ipfsURL string) string {
+	return strings.TrimRight(gw, "/") + "/ipfs/" +
+		strings.TrimLeft(ipfsURL, "/")
+}
 
-	// If we went down a branch that marked shouldCache true then lets add the
-	// cache entry into the cache
-	if shouldCache && d.cacheEngine != nil {
-		err = d.cacheEngine.Set(u, doc, expireTime)
-		if err != nil {
-			return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
-		}
+type contextDocumentLoader struct {
+	ctx    context.Context
+	loader ld.DocumentLoader
+}
+
+func (l contextDocumentLoader) LoadDocument(
+	u string) (*ld.RemoteDocument, error) {
+
+	if cl, ok := l.loader.(DocumentLoader); ok {
+		return cl.LoadDocumentWithContext(l.ctx, u)
+	}
+	if err := l.ctx.Err(); err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+	// the loader would silently ignore pins
+	ctxPins, _ := l.ctx.Value(pinsKey{}).(map[string]string)
+	if _, ok := ctxPins[u]; ok {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed,
+			fmt.Errorf("%w: %v", ErrPinsNotSupported, u))
 	}
+	return l.loader.LoadDocument(u)
+}
 
-	return doc, nil
+// BindContext returns the loader that loads documents with ctx. It allows to
+// cancel loading of documents requested by json-gold processing, which calls
+// LoadDocument without the context. If loader does not implement
+// DocumentLoader, the context is checked only before loading, and documents
+// pinned with ContextWithPinnedDigests are rejected with ErrPinsNotSupported.
+func BindContext(ctx context.Context,
+	loader ld.DocumentLoader) ld.DocumentLoader {
+
+	if loader == nil {
+		return nil
+	}
+	return contextDocumentLoader{ctx: ctx, loader: loader}
 }
@@ -0,0 +1,200 @@
+package loaders
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piprate/json-gold/ld"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIPFSURL = "ipfs://QmdH1Vu79p2NcZLFbHxzJnLuUHJiMZnBeT7SNpLaqK7k9X"
+	testIPFSDoc = `{"@context":{"name":"https://schema.org/name"}}`
+)
+
+type mockIPFSClient struct {
+	docs  map[string]string
+	calls int
+}
+
+func (c *mockIPFSClient) Cat(url string) (io.ReadCloser, error) {
+	c.calls++
+	doc, ok := c.docs[url]
+	if !ok {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return io.NopCloser(strings.NewReader(doc)), nil
+}
+
+func TestDocumentLoader_IPFSNodeCache(t *testing.T) {
+	ipfsCli := &mockIPFSClient{docs: map[string]string{
+		strings.TrimPrefix(testIPFSURL, "ipfs://"): testIPFSDoc}}
+	cache, err := NewMemoryCacheEngine()
+	require.NoError(t, err)
+	loader := NewDocumentLoader(ipfsCli, "", WithCacheEngine(cache))
+
+	doc, err := loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, testIPFSURL, doc.DocumentURL)
+
+	doc2, err := loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, doc, doc2)
+	require.Equal(t, 1, ipfsCli.calls)
+
+	_, expireTime, err := cache.Get(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, noExpireTime, expireTime)
+}
+
+func TestDocumentLoader_IPFSGatewayCache(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.Path)
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+
+	cache, err := NewMemoryCacheEngine()
+	require.NoError(t, err)
+	loader := NewDocumentLoader(nil, srv.URL, WithCacheEngine(cache))
+
+	doc, err := loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, testIPFSURL, doc.DocumentURL)
+
+	_, err = loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/ipfs/" +
+		strings.TrimPrefix(testIPFSURL, "ipfs://")}, requests)
+
+	// the document is cached by the ipfs:// URL only
+	stats := cache.(CacheStatsReporter).Stats()
+	require.Equal(t, 1, stats.Entries)
+	_, expireTime, err := cache.Get(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, noExpireTime, expireTime)
+}
+
+func TestDocumentLoader_IPFSEmbeddedDocument(t *testing.T) {
+	cache, err := NewMemoryCacheEngine(
+		WithEmbeddedDocumentBytes(testIPFSURL, []byte(testIPFSDoc)))
+	require.NoError(t, err)
+
+	// IPFS is not configured, so the document may come from the cache only
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(cache))
+	doc, err := loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, testIPFSURL, doc.DocumentURL)
+	require.Equal(t,
+		map[string]any{"@context": map[string]any{
+			"name": "https://schema.org/name"}},
+		doc.Document)
+}
+
+func TestDocumentLoader_IPFSNoCache(t *testing.T) {
+	ipfsCli := &mockIPFSClient{docs: map[string]string{
+		strings.TrimPrefix(testIPFSURL, "ipfs://"): testIPFSDoc}}
+	loader := NewDocumentLoader(ipfsCli, "", WithCacheEngine(nil))
+
+	for i := 0; i < 2; i++ {
+		_, err := loader.LoadDocument(testIPFSURL)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, ipfsCli.calls)
+}
+
+type blockingIPFSClient struct {
+	release chan struct{}
+}
+
+func (c blockingIPFSClient) Cat(string) (io.ReadCloser, error) {
+	<-c.release
+	return io.NopCloser(strings.NewReader(testIPFSDoc)), nil
+}
+
+func TestDocumentLoader_LoadDocumentWithContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}))
+	defer srv.Close()
+
+	t.Run("http", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			50*time.Millisecond)
+		defer cancel()
+
+		loader := NewDocumentLoader(nil, "")
+		_, err := loader.LoadDocumentWithContext(ctx,
+			srv.URL+"/context.jsonld")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("ipfs gateway", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			50*time.Millisecond)
+		defer cancel()
+
+		loader := NewDocumentLoader(nil, srv.URL)
+		_, err := loader.LoadDocumentWithContext(ctx, testIPFSURL)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("ipfs node", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			50*time.Millisecond)
+		defer cancel()
+
+		loader := NewDocumentLoader(blockingIPFSClient{release}, "")
+		_, err := loader.LoadDocumentWithContext(ctx, testIPFSURL)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+type countingLoader struct {
+	calls int
+}
+
+func (l *countingLoader) LoadDocument(u string) (*ld.RemoteDocument, error) {
+	l.calls++
+	return &ld.RemoteDocument{DocumentURL: u}, nil
+}
+
+func TestBindContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// loader without context support is called until ctx is canceled
+	plainLoader := &countingLoader{}
+	loader := BindContext(ctx, plainLoader)
+	_, err := loader.LoadDocument("https://example.com/context.jsonld")
+	require.NoError(t, err)
+	cancel()
+	_, err = loader.LoadDocument("https://example.com/context.jsonld")
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, plainLoader.calls)
+
+	// context aware loader gets the context
+	ipfsCli := &mockIPFSClient{docs: map[string]string{
+		strings.TrimPrefix(testIPFSURL, "ipfs://"): testIPFSDoc}}
+	loader = BindContext(ctx, NewDocumentLoader(ipfsCli, ""))
+	_, err = loader.LoadDocument(testIPFSURL)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 0, ipfsCli.calls)
+
+	require.Nil(t, BindContext(ctx, nil))
+}
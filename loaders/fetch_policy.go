@@ -0,0 +1,344 @@
+package loaders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/piprate/json-gold/ld"
+)
+
+const (
+	defaultMaxRedirects      = 10
+	defaultMaxAlternateLinks = 10
+)
+
+var (
+	// ErrURLNotAllowed is returned for URLs rejected by the scheme and host
+	// lists of the loader, and for hosts in private networks if they are
+	// blocked
+	ErrURLNotAllowed = errors.New("URL is not allowed")
+	// ErrDocumentTooLarge is returned if the document exceeds the size
+	// limit of the loader
+	ErrDocumentTooLarge = errors.New("document is too large")
+	// ErrTooManyRedirects is returned if the loader reaches the limit of
+	// HTTP redirects or JSON-LD alternate links
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// WithAllowedSchemes restricts URL schemes of loaded documents, e.g.
+// "https" and "ipfs". By default, all supported schemes are allowed.
+// Documents from bundles are not restricted.
+func WithAllowedSchemes(schemes ...string) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.allowedSchemes = appendLower(loader.allowedSchemes, schemes)
+	}
+}
+
+// WithDeniedSchemes forbids loading documents with the URL schemes
+func WithDeniedSchemes(schemes ...string) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.deniedSchemes = appendLower(loader.deniedSchemes, schemes)
+	}
+}
+
+// WithAllowedHosts restricts hosts of HTTP documents. A host is either the
+// exact host name, or "*.example.com" that matches all subdomains of
+// example.com. Redirects are checked too. The IPFS gateway is not
+// restricted.
+func WithAllowedHosts(hosts ...string) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.allowedHosts = appendLower(loader.allowedHosts, hosts)
+	}
+}
+
+// WithDeniedHosts forbids loading HTTP documents from the hosts. Hosts have
+// the same format as in WithAllowedHosts. Denied hosts take precedence over
+// allowed ones.
+func WithDeniedHosts(hosts ...string) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.deniedHosts = appendLower(loader.deniedHosts, hosts)
+	}
+}
+
+// WithPrivateNetworksBlocked forbids HTTP connections to loopback, private
+// and link-local addresses, so untrusted documents can't make the loader
+// reach internal services. If the HTTP client uses *http.Transport, the
+// addresses are checked when dialing and its DialContext is replaced.
+// Otherwise, host names are resolved and checked before each request. The
+// IPFS gateway is not restricted.
+func WithPrivateNetworksBlocked() DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.blockPrivateNetworks = true
+	}
+}
+
+// WithMaxDocumentSize limits the size of documents downloaded over HTTP or
+// from IPFS. Zero means no limit.
+func WithMaxDocumentSize(n int64) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.maxDocumentSize = n
+	}
+}
+
+// WithMaxRedirects limits the number of HTTP redirects followed for a
+// document. Zero disables redirects. Default is 10.
+func WithMaxRedirects(n int) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		if n < 0 {
+			n = 0
+		}
+		loader.maxRedirects = n
+	}
+}
+
+// WithMaxAlternateLinks limits the depth of JSON-LD alternate links
+// (Link: <...>; rel="alternate"; type="application/ld+json") followed for a
+// document. Zero disables alternate links. Default is 10.
+func WithMaxAlternateLinks(n int) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		if n < 0 {
+			n = 0
+		}
+		loader.maxAlternateLinks = n
+	}
+}
+
+// WithRequestTimeout limits the time of each HTTP request, including
+// reading of the response, and each IPFS request. Zero means no limit.
+func WithRequestTimeout(timeout time.Duration) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.requestTimeout = timeout
+	}
+}
+
+func appendLower(dst []string, values []string) []string {
+	for _, v := range values {
+		dst = append(dst, strings.ToLower(v))
+	}
+	return dst
+}
+
+// checkURL returns an error if the URL is rejected by scheme and host lists
+func (d *documentLoader) checkURL(u string) error {
+	if len(d.allowedSchemes) == 0 && len(d.deniedSchemes) == 0 &&
+		len(d.allowedHosts) == 0 && len(d.deniedHosts) == 0 {
+
+		return nil
+	}
+
+	pu, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrURLNotAllowed, err)
+	}
+
+	scheme := strings.ToLower(pu.Scheme)
+	if !isAllowed(scheme, d.allowedSchemes, d.deniedSchemes, matchScheme) {
+		return fmt.Errorf("%w: %v", ErrURLNotAllowed, u)
+	}
+
+	if scheme != "http" && scheme != "https" {
+		return nil
+	}
+	host := strings.ToLower(pu.Hostname())
+	if !isAllowed(host, d.allowedHosts, d.deniedHosts, matchHost) {
+		return fmt.Errorf("%w: %v", ErrURLNotAllowed, u)
+	}
+	return nil
+}
+
+func isAllowed(v string, allowed, denied []string,
+	match func(pattern, v string) bool) bool {
+
+	for _, p := range denied {
+		if match(p, v) {
+			return false
+		}
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, p := range allowed {
+		if match(p, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchScheme(pattern, scheme string) bool {
+	return pattern == scheme
+}
+
+func matchHost(pattern, host string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return pattern == host
+}
+
+// newRemoteClient returns the HTTP client for untrusted URLs. It limits
+// redirects, checks redirect URLs and blocks private networks if required.
+// The client of the loader is not modified, and its transport is cloned
+// before restricting, as it is still used for the IPFS gateway.
+func (d *documentLoader) newRemoteClient() *http.Client {
+	c := d.newRedirectLimitedClient(d.checkURL)
+	if d.blockPrivateNetworks {
+		c.Transport = blockPrivateNetworks(c.Transport)
+	}
+	return c
+}
+
+// newRewriteClient returns the HTTP client for rewritten URLs. They are
+// configured by the operator and trusted like the IPFS gateway, so only the
+// number of redirects is limited.
+func (d *documentLoader) newRewriteClient() *http.Client {
+	return d.newRedirectLimitedClient(nil)
+}
+
+// newRedirectLimitedClient returns the copy of the loader's client that
+// limits redirects and checks redirect URLs with checkURL if it is not nil
+func (d *documentLoader) newRedirectLimitedClient(
+	checkURL func(u string) error) *http.Client {
+
+	base := d.httpClient
+	if base == nil {
+		base = &http.Client{}
+	}
+
+	// nil transport is resolved to http.DefaultTransport on each request
+	return &http.Client{
+		Transport: base.Transport,
+		Jar:       base.Jar,
+		Timeout:   base.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > d.maxRedirects {
+				return fmt.Errorf("%w: stopped after %d redirects",
+					ErrTooManyRedirects, d.maxRedirects)
+			}
+			if checkURL != nil {
+				if err := checkURL(req.URL.String()); err != nil {
+					return err
+				}
+			}
+			if base.CheckRedirect != nil {
+				return base.CheckRedirect(req, via)
+			}
+			return nil
+		},
+	}
+}
+
+func blockPrivateNetworks(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return privateNetworkGuard{rt}
+	}
+
+	// checking the address after resolving prevents DNS rebinding
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   denyPrivateAddress,
+	}
+	t = t.Clone()
+	t.DialContext = dialer.DialContext
+	return t
+}
+
+func denyPrivateAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || isPrivateIP(ip) {
+		return fmt.Errorf("%w: private address %v", ErrURLNotAllowed, host)
+	}
+	return nil
+}
+
+// privateNetworkGuard checks the request host before passing the request to
+// the transport that can't be restricted on dialing
+type privateNetworkGuard struct {
+	next http.RoundTripper
+}
+
+func (g privateNetworkGuard) RoundTrip(
+	req *http.Request) (*http.Response, error) {
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(req.Context(),
+		req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if isPrivateIP(addr.IP) {
+			return nil, fmt.Errorf("%w: private address %v",
+				ErrURLNotAllowed, addr.IP)
+		}
+	}
+	return g.next.RoundTrip(req)
+}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast()
+}
+
+// readDocument parses the document from r respecting the size limit
+func (d *documentLoader) readDocument(r io.Reader) (any, error) {
+	if d.maxDocumentSize <= 0 {
+		return ld.DocumentFromReader(r)
+	}
+
+	lr := &io.LimitedReader{R: r, N: d.maxDocumentSize + 1}
+	document, err := ld.DocumentFromReader(lr)
+	if lr.N <= 0 {
+		return nil, d.documentTooLargeError()
+	}
+	return document, err
+}
+
+func (d *documentLoader) documentTooLargeError() error {
+	return ld.NewJsonLdError(ld.LoadingDocumentFailed,
+		fmt.Errorf("%w: limit is %d bytes", ErrDocumentTooLarge,
+			d.maxDocumentSize))
+}
+
+// withRequestTimeout returns the context of a single request
+func (d *documentLoader) withRequestTimeout(
+	ctx context.Context) (context.Context, context.CancelFunc) {
+
+	if d.requestTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d.requestTimeout)
+}
+
+type alternateLinkDepthKey struct{}
+
+// withAlternateLink returns the context to load the document from the
+// alternate link, or an error if the depth limit is reached
+func (d *documentLoader) withAlternateLink(ctx context.Context,
+	u string) (context.Context, error) {
+
+	depth, _ := ctx.Value(alternateLinkDepthKey{}).(int)
+	if depth >= d.maxAlternateLinks {
+		return nil, fmt.Errorf("%w: stopped after %d alternate links: %v",
+			ErrTooManyRedirects, d.maxAlternateLinks, u)
+	}
+	return context.WithValue(ctx, alternateLinkDepthKey{}, depth+1), nil
+}
@@ -0,0 +1,310 @@
+package loaders
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newDocumentServer(t testing.TB) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDocumentLoader_SchemeLists(t *testing.T) {
+	srv := newDocumentServer(t)
+	u := srv.URL + "/context.jsonld"
+	ipfsCli := &mockIPFSClient{docs: map[string]string{
+		strings.TrimPrefix(testIPFSURL, "ipfs://"): testIPFSDoc}}
+
+	loader := NewDocumentLoader(ipfsCli, "", WithCacheEngine(nil),
+		WithAllowedSchemes("HTTPS", "ipfs"))
+	_, err := loader.LoadDocument(u)
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+	_, err = loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+
+	loader = NewDocumentLoader(ipfsCli, "", WithCacheEngine(nil),
+		WithDeniedSchemes("ipfs"))
+	_, err = loader.LoadDocument(u)
+	require.NoError(t, err)
+	_, err = loader.LoadDocument(testIPFSURL)
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+}
+
+func TestDocumentLoader_HostLists(t *testing.T) {
+	srv := newDocumentServer(t)
+	u := srv.URL + "/context.jsonld"
+
+	testCases := []struct {
+		name    string
+		opts    []DocumentLoaderOption
+		allowed bool
+	}{
+		{
+			name:    "allowed host",
+			opts:    []DocumentLoaderOption{WithAllowedHosts("127.0.0.1")},
+			allowed: true,
+		},
+		{
+			name: "not allowed host",
+			opts: []DocumentLoaderOption{
+				WithAllowedHosts("example.com", "*.example.com")},
+		},
+		{
+			name: "denied host",
+			opts: []DocumentLoaderOption{WithDeniedHosts("127.0.0.1")},
+		},
+		{
+			name: "denied precedes allowed",
+			opts: []DocumentLoaderOption{WithAllowedHosts("127.0.0.1"),
+				WithDeniedHosts("127.0.0.1")},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]DocumentLoaderOption{WithCacheEngine(nil)},
+				tc.opts...)
+			loader := NewDocumentLoader(nil, "", opts...)
+			_, err := loader.LoadDocument(u)
+			if tc.allowed {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, ErrURLNotAllowed)
+			}
+		})
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	require.True(t, matchHost("example.com", "example.com"))
+	require.False(t, matchHost("example.com", "www.example.com"))
+	require.True(t, matchHost("*.example.com", "www.example.com"))
+	require.True(t, matchHost("*.example.com", "a.b.example.com"))
+	require.False(t, matchHost("*.example.com", "example.com"))
+	require.False(t, matchHost("*.example.com", "badexample.com"))
+}
+
+func TestDocumentLoader_RedirectToNotAllowedHost(t *testing.T) {
+	target := newDocumentServer(t)
+	targetURL, err := url.Parse(target.URL)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://localhost:"+targetURL.Port()+
+				"/context.jsonld", http.StatusFound)
+		}))
+	defer srv.Close()
+
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(nil),
+		WithAllowedHosts("127.0.0.1"))
+	_, err = loader.LoadDocument(srv.URL + "/context.jsonld")
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+}
+
+type countingRoundTripper struct {
+	calls int32
+}
+
+func (rt *countingRoundTripper) RoundTrip(
+	req *http.Request) (*http.Response, error) {
+
+	atomic.AddInt32(&rt.calls, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestDocumentLoader_PrivateNetworksBlocked(t *testing.T) {
+	srv := newDocumentServer(t)
+	u := srv.URL + "/context.jsonld"
+
+	t.Run("http transport", func(t *testing.T) {
+		loader := NewDocumentLoader(nil, "", WithCacheEngine(nil),
+			WithPrivateNetworksBlocked())
+		_, err := loader.LoadDocument(u)
+		require.ErrorIs(t, err, ErrURLNotAllowed)
+	})
+
+	t.Run("custom transport", func(t *testing.T) {
+		rt := &countingRoundTripper{}
+		loader := NewDocumentLoader(nil, "", WithCacheEngine(nil),
+			WithHTTPClient(&http.Client{Transport: rt}),
+			WithPrivateNetworksBlocked())
+		_, err := loader.LoadDocument(u)
+		require.ErrorIs(t, err, ErrURLNotAllowed)
+		require.Equal(t, int32(0), atomic.LoadInt32(&rt.calls))
+	})
+
+	t.Run("client is not modified", func(t *testing.T) {
+		transport := &http.Transport{}
+		httpClient := &http.Client{Transport: transport}
+		defaultTransport := http.DefaultTransport
+		_ = NewDocumentLoader(nil, "", WithHTTPClient(httpClient),
+			WithPrivateNetworksBlocked())
+		_ = NewDocumentLoader(nil, "", WithPrivateNetworksBlocked())
+		require.Same(t, transport, httpClient.Transport)
+		require.Nil(t, transport.DialContext)
+		require.Nil(t, httpClient.CheckRedirect)
+		require.Equal(t, defaultTransport, http.DefaultTransport)
+		require.Nil(t, http.DefaultClient.CheckRedirect)
+	})
+
+	t.Run("ipfs gateway", func(t *testing.T) {
+		loader := NewDocumentLoader(nil, srv.URL, WithCacheEngine(nil),
+			WithPrivateNetworksBlocked())
+		_, err := loader.LoadDocument(testIPFSURL)
+		require.NoError(t, err)
+	})
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1",
+		"192.168.1.1", "169.254.169.254", "0.0.0.0", "::1", "fe80::1",
+		"fd00::1"} {
+
+		require.True(t, isPrivateIP(parseIP(t, ip)), ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "2001:4860:4860::8888"} {
+		require.False(t, isPrivateIP(parseIP(t, ip)), ip)
+	}
+}
+
+func TestDocumentLoader_MaxDocumentSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("chunked") != "" {
+				// no Content-Length, the size is checked while reading
+				w.(http.Flusher).Flush()
+			}
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+
+	for _, query := range []string{"", "?chunked=1"} {
+		u := srv.URL + "/context.jsonld" + query
+		loader := NewDocumentLoader(nil, "", WithCacheEngine(nil),
+			WithMaxDocumentSize(int64(len(testIPFSDoc))))
+		_, err := loader.LoadDocument(u)
+		require.NoError(t, err, u)
+
+		loader = NewDocumentLoader(nil, "", WithCacheEngine(nil),
+			WithMaxDocumentSize(int64(len(testIPFSDoc)-1)))
+		_, err = loader.LoadDocument(u)
+		require.ErrorIs(t, err, ErrDocumentTooLarge, u)
+	}
+
+	ipfsCli := &mockIPFSClient{docs: map[string]string{
+		strings.TrimPrefix(testIPFSURL, "ipfs://"): testIPFSDoc}}
+	loader := NewDocumentLoader(ipfsCli, "", WithCacheEngine(nil),
+		WithMaxDocumentSize(10))
+	_, err := loader.LoadDocument(testIPFSURL)
+	require.ErrorIs(t, err, ErrDocumentTooLarge)
+}
+
+func TestDocumentLoader_MaxRedirects(t *testing.T) {
+	// /redirect/N redirects N times before serving the document
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path,
+				"/redirect/"))
+			if n > 0 {
+				http.Redirect(w, r, fmt.Sprintf("/redirect/%d", n-1),
+					http.StatusFound)
+				return
+			}
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(nil),
+		WithMaxRedirects(2))
+	_, err := loader.LoadDocument(srv.URL + "/redirect/2")
+	require.NoError(t, err)
+	_, err = loader.LoadDocument(srv.URL + "/redirect/3")
+	require.ErrorIs(t, err, ErrTooManyRedirects)
+
+	loader = NewDocumentLoader(nil, "", WithCacheEngine(nil),
+		WithMaxRedirects(0))
+	_, err = loader.LoadDocument(srv.URL + "/redirect/1")
+	require.ErrorIs(t, err, ErrTooManyRedirects)
+
+	// the default limit is 10 redirects
+	loader = NewDocumentLoader(nil, "", WithCacheEngine(nil))
+	_, err = loader.LoadDocument(srv.URL + "/redirect/10")
+	require.NoError(t, err)
+	_, err = loader.LoadDocument(srv.URL + "/redirect/11")
+	require.ErrorIs(t, err, ErrTooManyRedirects)
+}
+
+func TestDocumentLoader_MaxAlternateLinks(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			// the document links to itself
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Link", `<`+r.URL.Path+
+				`>; rel="alternate"; type="application/ld+json"`)
+			_, _ = io.WriteString(w, "<html></html>")
+		}))
+	defer srv.Close()
+
+	u := srv.URL + "/context.jsonld"
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(nil))
+	_, err := loader.LoadDocument(u)
+	require.ErrorIs(t, err, ErrTooManyRedirects)
+	require.Equal(t, int32(defaultMaxAlternateLinks+1),
+		atomic.LoadInt32(&requests))
+
+	atomic.StoreInt32(&requests, 0)
+	loader = NewDocumentLoader(nil, "", WithCacheEngine(nil),
+		WithMaxAlternateLinks(0))
+	_, err = loader.LoadDocument(u)
+	require.ErrorIs(t, err, ErrTooManyRedirects)
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestDocumentLoader_RequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}))
+	defer srv.Close()
+
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(nil),
+		WithRequestTimeout(50*time.Millisecond))
+	_, err := loader.LoadDocument(srv.URL + "/context.jsonld")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	loader = NewDocumentLoader(blockingIPFSClient{release}, "",
+		WithCacheEngine(nil), WithRequestTimeout(50*time.Millisecond))
+	_, err = loader.LoadDocument(testIPFSURL)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func parseIP(t testing.TB, s string) net.IP {
+	ip := net.ParseIP(s)
+	require.NotNil(t, ip)
+	return ip
+}
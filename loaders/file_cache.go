@@ -0,0 +1,282 @@
+package loaders
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/piprate/json-gold/ld"
+)
+
+const (
+	fileCacheExt       = ".json"
+	fileCacheTmpPrefix = ".tmp-"
+
+	// temporary files older than this are left by crashed writers
+	fileCacheStaleTmpAge = time.Hour
+)
+
+type fileCacheEntry struct {
+	Key          string          `json:"key"`
+	DocumentURL  string          `json:"documentUrl"`
+	ContextURL   string          `json:"contextUrl,omitempty"`
+	Document     json.RawMessage `json:"document,omitempty"`
+	ExpireTime   time.Time       `json:"expireTime"`
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"lastModified,omitempty"`
+	StaleUntil   time.Time       `json:"staleUntil,omitempty"`
+}
+
+// fileCacheEngine stores every document in its own file named after the
+// hash of the key. Files are replaced atomically with rename, so several
+// processes may share one directory without locks: readers always see either
+// the old or the new version of the entry.
+type fileCacheEngine struct {
+	dir string
+}
+
+// NewFileCacheEngine creates a CacheEngine that persists documents in the
+// directory, so they survive process restarts. The directory is created if
+// it does not exist. Corrupted entries are treated as cache misses and
+// removed.
+func NewFileCacheEngine(dir string) (CacheEngine, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &fileCacheEngine{dir: dir}
+	e.removeStaleTmpFiles()
+	return e, nil
+}
+
+func (e *fileCacheEngine) Get(
+	key string) (*ld.RemoteDocument, time.Time, error) {
+
+	entry, err := e.GetEntry(key)
+	return entry.Document, entry.ExpireTime, err
+}
+
+func (e *fileCacheEngine) GetEntry(key string) (CacheEntry, error) {
+	_, entry, err := e.readEntry(e.fileName(key), key)
+	return entry, err
+}
+
+// readEntry reads the entry file. If key is not empty, the entry must have
+// this key.
+func (e *fileCacheEngine) readEntry(fName string,
+	key string) (string, CacheEntry, error) {
+
+	f, err := os.Open(fName)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", CacheEntry{}, ErrCacheMiss
+	} else if err != nil {
+		return "", CacheEntry{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", CacheEntry{}, err
+	}
+
+	var entry fileCacheEntry
+	err = json.NewDecoder(f).Decode(&entry)
+	if err != nil || (key != "" && entry.Key != key) {
+		e.removeCorrupted(fName, fi)
+		return "", CacheEntry{}, ErrCacheMiss
+	}
+
+	// the document is omitted if the nil one was cached
+	var doc *ld.RemoteDocument
+	if entry.Document != nil {
+		doc = &ld.RemoteDocument{
+			DocumentURL: entry.DocumentURL,
+			ContextURL:  entry.ContextURL,
+		}
+		err = json.Unmarshal(entry.Document, &doc.Document)
+		if err != nil {
+			e.removeCorrupted(fName, fi)
+			return "", CacheEntry{}, ErrCacheMiss
+		}
+	}
+
+	return entry.Key, CacheEntry{
+		Document:     doc,
+		ExpireTime:   entry.ExpireTime,
+		ETag:         entry.ETag,
+		LastModified: entry.LastModified,
+		StaleUntil:   entry.StaleUntil,
+	}, nil
+}
+
+func (e *fileCacheEngine) Set(key string, doc *ld.RemoteDocument,
+	expireTime time.Time) error {
+
+	return e.SetEntry(key, CacheEntry{Document: doc, ExpireTime: expireTime})
+}
+
+func (e *fileCacheEngine) SetEntry(key string, entry CacheEntry) error {
+	fe := fileCacheEntry{
+		Key:          key,
+		ExpireTime:   entry.ExpireTime,
+		ETag:         entry.ETag,
+		LastModified: entry.LastModified,
+		StaleUntil:   entry.StaleUntil,
+	}
+	if entry.Document != nil {
+		var err error
+		fe.DocumentURL = entry.Document.DocumentURL
+		fe.ContextURL = entry.Document.ContextURL
+		fe.Document, err = json.Marshal(entry.Document.Document)
+		if err != nil {
+			return err
+		}
+	}
+
+	entryBytes, err := json.Marshal(fe)
+	if err != nil {
+		return err
+	}
+
+	return e.writeFile(e.fileName(key), entryBytes)
+}
+
+func (e *fileCacheEngine) Delete(key string) error {
+	err := os.Remove(e.fileName(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (e *fileCacheEngine) Purge() error {
+	names, err := e.entryFileNames()
+	if err != nil {
+		return err
+	}
+	for _, fName := range names {
+		err = os.Remove(fName)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *fileCacheEngine) Keys() ([]string, error) {
+	var keys []string
+	err := e.Range(func(key string, _ CacheEntry) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys, err
+}
+
+// Range iterates cached documents in the order of their file names. Entries
+// removed or corrupted during the iteration are skipped.
+func (e *fileCacheEngine) Range(
+	fn func(key string, entry CacheEntry) bool) error {
+
+	names, err := e.entryFileNames()
+	if err != nil {
+		return err
+	}
+	for _, fName := range names {
+		key, entry, err := e.readEntry(fName, "")
+		if errors.Is(err, ErrCacheMiss) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !fn(key, entry) {
+			break
+		}
+	}
+	return nil
+}
+
+// entryFileNames returns paths of all entry files in the cache directory
+func (e *fileCacheEngine) entryFileNames() ([]string, error) {
+	entries, err := os.ReadDir(e.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, de := range entries {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), fileCacheExt) ||
+			strings.HasPrefix(de.Name(), fileCacheTmpPrefix) {
+
+			continue
+		}
+		names = append(names, filepath.Join(e.dir, de.Name()))
+	}
+	return names, nil
+}
+
+// writeFile writes data to the temporary file in the cache directory and
+// renames it to fName
+func (e *fileCacheEngine) writeFile(fName string, data []byte) error {
+	f, err := os.CreateTemp(e.dir, fileCacheTmpPrefix+"*")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	defer func() {
+		// no-op if the file was renamed
+		_ = os.Remove(tmpName)
+	}()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpName, fName)
+}
+
+// removeCorrupted removes the entry file if it was not replaced by another
+// writer since it was opened
+func (e *fileCacheEngine) removeCorrupted(fName string, opened os.FileInfo) {
+	fi, err := os.Stat(fName)
+	if err != nil || !os.SameFile(fi, opened) {
+		return
+	}
+	_ = os.Remove(fName)
+}
+
+func (e *fileCacheEngine) removeStaleTmpFiles() {
+	entries, err := os.ReadDir(e.dir)
+	if err != nil {
+		return
+	}
+	for _, de := range entries {
+		if de.IsDir() || !strings.HasPrefix(de.Name(), fileCacheTmpPrefix) {
+			continue
+		}
+		fi, err := de.Info()
+		if err != nil || time.Since(fi.ModTime()) < fileCacheStaleTmpAge {
+			continue
+		}
+		_ = os.Remove(filepath.Join(e.dir, de.Name()))
+	}
+}
+
+func (e *fileCacheEngine) fileName(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return filepath.Join(e.dir, hex.EncodeToString(h[:])+fileCacheExt)
+}
@@ -0,0 +1,252 @@
+package loaders
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/piprate/json-gold/ld"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCacheEngine(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewFileCacheEngine(dir)
+	require.NoError(t, err)
+
+	const u = "https://example.com/context.jsonld"
+	_, _, err = cache.Get(u)
+	require.ErrorIs(t, err, ErrCacheMiss)
+
+	doc := &ld.RemoteDocument{
+		DocumentURL: "https://example.com/context-v1.jsonld",
+		ContextURL:  "https://example.com/link.jsonld",
+		Document: map[string]any{
+			"@context": map[string]any{"name": "https://schema.org/name"},
+			"num":      float64(1),
+		},
+	}
+	expireTime := time.Date(2030, 1, 2, 3, 4, 5, 6, time.UTC)
+	err = cache.Set(u, doc, expireTime)
+	require.NoError(t, err)
+
+	// new engine on the same directory sees documents of the previous one
+	cache2, err := NewFileCacheEngine(dir)
+	require.NoError(t, err)
+	doc2, expireTime2, err := cache2.Get(u)
+	require.NoError(t, err)
+	require.Equal(t, doc, doc2)
+	require.True(t, expireTime.Equal(expireTime2))
+
+	// no temporary files left
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestFileCacheEngine_NilDocument(t *testing.T) {
+	cache, err := NewFileCacheEngine(t.TempDir())
+	require.NoError(t, err)
+
+	// unlike the nil document, the null one is kept
+	expireTime := time.Now().Add(time.Hour)
+	require.NoError(t, cache.Set("a", nil, expireTime))
+	require.NoError(t, cache.Set("b", &ld.RemoteDocument{DocumentURL: "b"},
+		expireTime))
+
+	doc, _, err := cache.Get("a")
+	require.NoError(t, err)
+	require.Nil(t, doc)
+	doc, _, err = cache.Get("b")
+	require.NoError(t, err)
+	require.Equal(t, &ld.RemoteDocument{DocumentURL: "b"}, doc)
+}
+
+func TestFileCacheEngine_Entry(t *testing.T) {
+	cache, err := NewFileCacheEngine(t.TempDir())
+	require.NoError(t, err)
+	ec := cache.(EntryCacheEngine)
+
+	const u = "https://example.com/context.jsonld"
+	expireTime := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry := CacheEntry{
+		Document: &ld.RemoteDocument{DocumentURL: u,
+			Document: map[string]any{}},
+		ExpireTime:   expireTime,
+		ETag:         `"v1"`,
+		LastModified: "Wed, 21 Oct 2015 07:28:00 GMT",
+		StaleUntil:   expireTime.Add(time.Hour),
+	}
+	require.NoError(t, ec.SetEntry(u, entry))
+
+	entry2, err := ec.GetEntry(u)
+	require.NoError(t, err)
+	require.Equal(t, entry, entry2)
+}
+
+func TestFileCacheEngine_Corrupted(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewFileCacheEngine(dir)
+	require.NoError(t, err)
+
+	const u = "https://example.com/context.jsonld"
+	err = cache.Set(u, &ld.RemoteDocument{DocumentURL: u,
+		Document: map[string]any{}}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	fName := cache.(*fileCacheEngine).fileName(u)
+	err = os.WriteFile(fName, []byte(`{"key":"https://example.com/con`),
+		0o644)
+	require.NoError(t, err)
+
+	_, _, err = cache.Get(u)
+	require.ErrorIs(t, err, ErrCacheMiss)
+	_, err = os.Stat(fName)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// entry is recovered on the next Set
+	err = cache.Set(u, &ld.RemoteDocument{DocumentURL: u,
+		Document: map[string]any{}}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, _, err = cache.Get(u)
+	require.NoError(t, err)
+}
+
+func TestFileCacheEngine_StaleTmpFiles(t *testing.T) {
+	dir := t.TempDir()
+	staleTmp := filepath.Join(dir, fileCacheTmpPrefix+"1")
+	freshTmp := filepath.Join(dir, fileCacheTmpPrefix+"2")
+	require.NoError(t, os.WriteFile(staleTmp, []byte("{"), 0o644))
+	require.NoError(t, os.WriteFile(freshTmp, []byte("{"), 0o644))
+	old := time.Now().Add(-2 * fileCacheStaleTmpAge)
+	require.NoError(t, os.Chtimes(staleTmp, old, old))
+
+	_, err := NewFileCacheEngine(dir)
+	require.NoError(t, err)
+
+	_, err = os.Stat(staleTmp)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(freshTmp)
+	require.NoError(t, err)
+}
+
+func TestFileCacheEngine_ConcurrentWriters(t *testing.T) {
+	dir := t.TempDir()
+	const u = "https://example.com/context.jsonld"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		// every writer has its own engine like separate processes do
+		cache, err := NewFileCacheEngine(dir)
+		require.NoError(t, err)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				err := cache.Set(u, &ld.RemoteDocument{
+					DocumentURL: u,
+					Document:    map[string]any{"writer": float64(i)},
+				}, time.Now().Add(time.Hour))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_, _, err = cache.Get(u)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestFileCacheEngine_DocumentLoader(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Cache-Control", "max-age=3600")
+			w.Header().Set("Content-Type", "application/ld+json")
+			_, _ = fmt.Fprint(w,
+				`{"@context":{"name":"https://schema.org/name"}}`)
+		}))
+	u := srv.URL + "/context.jsonld"
+	dir := t.TempDir()
+
+	cache, err := NewFileCacheEngine(dir)
+	require.NoError(t, err)
+	doc, err := NewDocumentLoader(nil, "",
+		WithCacheEngine(cache)).LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, 1, requests)
+
+	// documents are loaded from the cache after restart even if the server
+	// is down
+	srv.Close()
+	cache, err = NewFileCacheEngine(dir)
+	require.NoError(t, err)
+	doc2, err := NewDocumentLoader(nil, "",
+		WithCacheEngine(cache)).LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, doc, doc2)
+	require.Equal(t, 1, requests)
+}
+
+func TestFileCacheEngine_Management(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewFileCacheEngine(dir)
+	require.NoError(t, err)
+	mc := cache.(ManagedCacheEngine)
+
+	expireTime := time.Now().Add(time.Hour)
+	urls := []string{"https://example.com/a", "https://example.com/b",
+		"https://example.com/c"}
+	for _, u := range urls {
+		require.NoError(t, cache.Set(u, testRemoteDocument(u), expireTime))
+	}
+	// temporary and corrupted files are skipped
+	require.NoError(t, os.WriteFile(filepath.Join(dir, fileCacheTmpPrefix+"1"),
+		[]byte("{"), 0o644))
+	corrupted := filepath.Join(dir, "corrupted"+fileCacheExt)
+	require.NoError(t, os.WriteFile(corrupted, []byte("{"), 0o644))
+
+	keys, err := mc.Keys()
+	require.NoError(t, err)
+	require.ElementsMatch(t, urls, keys)
+	_, err = os.Stat(corrupted)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	n := 0
+	err = mc.Range(func(key string, entry CacheEntry) bool {
+		require.Equal(t, key, entry.Document.DocumentURL)
+		require.True(t, expireTime.Equal(entry.ExpireTime))
+		n++
+		return false
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	require.NoError(t, mc.Delete(urls[0]))
+	require.NoError(t, mc.Delete(urls[0]))
+	_, _, err = cache.Get(urls[0])
+	require.ErrorIs(t, err, ErrCacheMiss)
+
+	require.NoError(t, mc.Purge())
+	keys, err = mc.Keys()
+	require.NoError(t, err)
+	require.Empty(t, keys)
+	_, err = os.Stat(filepath.Join(dir, fileCacheTmpPrefix+"1"))
+	require.NoError(t, err)
+}
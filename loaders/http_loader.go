@@ -0,0 +1,340 @@
+package loaders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/piprate/json-gold/ld"
+	"github.com/pquerna/cachecontrol"
+	"github.com/pquerna/cachecontrol/cacheobject"
+)
+
+const (
+	// An HTTP Accept header that prefers JSONLD.
+	acceptHeader = "application/ld+json, application/json;q=0.9, application/javascript;q=0.5, text/javascript;q=0.5, text/plain;q=0.2, */*;q=0.1"
+
+	// JSON-LD link header rel
+	linkHeaderRel = "http://www.w3.org/ns/json-ld#context"
+)
+
+var rApplicationJSON = regexp.MustCompile(`^application/(\w*\+)?json$`)
+
+// badStatusError is returned when the server responds with unexpected status
+type badStatusError struct {
+	statusCode int
+}
+
+func (e badStatusError) Error() string {
+	return fmt.Sprintf("Bad response status code: %d", e.statusCode)
+}
+
+// WithStaleWhileRevalidate allows the loader to serve the expired document
+// for up to grace after its expiration. The document is revalidated in
+// background, so the next loads get the fresh one.
+func WithStaleWhileRevalidate(grace time.Duration) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.staleWhileRevalidate = grace
+	}
+}
+
+// WithStaleIfError allows the loader to serve the expired document for up to
+// grace after its expiration if the server is unreachable or responds with
+// 5xx status.
+func WithStaleIfError(grace time.Duration) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.staleIfError = grace
+	}
+}
+
+// httpFetchResult is the result of the HTTP request
+type httpFetchResult struct {
+	entry CacheEntry
+	// notModified is true if the server responded with 304 to the
+	// conditional request, entry.Document is nil then
+	notModified bool
+	// shouldCache is true if the response headers allow to cache the
+	// document until entry.ExpireTime
+	shouldCache bool
+}
+
+func (d *documentLoader) loadDocumentFromHTTP(ctx context.Context,
+	u, src string) (*ld.RemoteDocument, error) {
+
+	cached, found, err := d.cacheEntry(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if found && cached.ExpireTime.After(now) {
+		d.observeCache(u, true)
+		return cached.Document, nil
+	}
+	if d.offline {
+		return nil, notBundledError(u)
+	}
+
+	if found && now.Before(cached.ExpireTime.Add(d.staleWhileRevalidate)) {
+		d.observeCache(u, true)
+		d.revalidateInBackground(u, src, cached)
+		return cached.Document, nil
+	}
+	d.observeCache(u, false)
+
+	var validators *CacheEntry
+	if found {
+		validators = &cached
+	}
+	doc, err := d.fetchAndCacheHTTP(ctx, u, src, validators)
+	if err != nil && found && isOriginError(ctx, err) &&
+		time.Now().Before(cached.ExpireTime.Add(d.staleIfError)) {
+
+		return cached.Document, nil
+	}
+	return doc, err
+}
+
+// revalidateInBackground starts revalidation of the cached document unless
+// it is already in progress
+func (d *documentLoader) revalidateInBackground(u, src string,
+	cached CacheEntry) {
+
+	d.revalidatingM.Lock()
+	if _, ok := d.revalidating[u]; ok {
+		d.revalidatingM.Unlock()
+		return
+	}
+	if d.revalidating == nil {
+		d.revalidating = make(map[string]struct{})
+	}
+	d.revalidating[u] = struct{}{}
+	d.revalidatingM.Unlock()
+
+	go func() {
+		defer func() {
+			d.revalidatingM.Lock()
+			delete(d.revalidating, u)
+			d.revalidatingM.Unlock()
+		}()
+
+		// the stale document is served until the revalidation succeeds
+		_, _ = d.fetchAndCacheHTTP(context.Background(), u, src, &cached)
+	}()
+}
+
+// fetchAndCacheHTTP downloads the document from src, or revalidates the
+// cached one if it is not nil, and puts the result into the cache under u
+func (d *documentLoader) fetchAndCacheHTTP(ctx context.Context, u, src string,
+	cached *CacheEntry) (*ld.RemoteDocument, error) {
+
+	// rewritten URLs are trusted
+	httpClient := d.remoteClient
+	if src != u {
+		httpClient = d.rewriteClient
+	}
+	res, err := d.fetchDocumentFromHTTP(ctx, httpClient, FetchSourceHTTP,
+		src, cached)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case res.notModified:
+		res.entry.Document = cached.Document
+		if res.entry.ETag == "" {
+			res.entry.ETag = cached.ETag
+		}
+		if res.entry.LastModified == "" {
+			res.entry.LastModified = cached.LastModified
+		}
+	case src != u:
+		// the document may be shared with the cache of an alternate link,
+		// so it is copied
+		doc := *res.entry.Document
+		doc.DocumentURL = u
+		res.entry.Document = &doc
+	}
+
+	// If we went down a branch that marked shouldCache true then lets add the
+	// cache entry into the cache
+	switch {
+	case d.cacheEngine == nil:
+	case res.shouldCache:
+		res.entry.StaleUntil = res.entry.ExpireTime.Add(d.staleGrace())
+		err = d.setCacheEntry(u, res.entry)
+	default:
+		// the previously cached document must not be served anymore
+		if mc, ok := d.cacheEngine.(ManagedCacheEngine); ok {
+			err = mc.Delete(u)
+		} else {
+			// the entry with zero expiration time is never served
+			err = d.setCacheEntry(u,
+				CacheEntry{Document: res.entry.Document})
+		}
+	}
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+
+	return res.entry.Document, nil
+}
+
+// staleGrace is the longest time the expired document may be served
+func (d *documentLoader) staleGrace() time.Duration {
+	if d.staleWhileRevalidate > d.staleIfError {
+		return d.staleWhileRevalidate
+	}
+	return d.staleIfError
+}
+
+// isOriginError reports if the error is caused by the server failure, not by
+// the caller
+func isOriginError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrURLNotAllowed) ||
+		errors.Is(err, ErrTooManyRedirects) {
+
+		return false
+	}
+	var statusErr badStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode >= http.StatusInternalServerError
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// fetchDocumentFromHTTP downloads the document bypassing the cache. If cached
+// is not nil, the request is conditional on its ETag and Last-Modified
+// validators.
+func (d *documentLoader) fetchDocumentFromHTTP(ctx context.Context,
+	httpClient *http.Client, source FetchSource, u string,
+	cached *CacheEntry) (res httpFetchResult, err error) {
+
+	// custom transports may ignore the context of the request
+	if err := ctx.Err(); err != nil {
+		return res, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+
+	var statusCode int
+	body := &countingReader{}
+	obs := d.startFetch(source, u)
+	defer func() { obs.finish(statusCode, body.n, err) }()
+
+	// alternate links are loaded with their own request timeout
+	parentCtx := ctx
+	ctx, cancel := d.withRequestTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u,
+		http.NoBody)
+	if err != nil {
+		return res, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+	// We prefer application/ld+json, but fallback to application/json
+	// or whatever is available
+	req.Header.Add("Accept", acceptHeader)
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return res, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	statusCode = resp.StatusCode
+	body.r = resp.Body
+
+	res.entry.ETag = resp.Header.Get("ETag")
+	res.entry.LastModified = resp.Header.Get("Last-Modified")
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		// headers of 304 response update the stored response, so the
+		// expiration is calculated as for 200
+		reasons, expireTime, err := cacheobject.UsingRequestResponse(req,
+			http.StatusOK, resp.Header, false)
+		res.notModified = true
+		res.shouldCache = err == nil && len(reasons) == 0
+		res.entry.ExpireTime = expireTime
+		return res, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return res, ld.NewJsonLdError(ld.LoadingDocumentFailed,
+			badStatusError{resp.StatusCode})
+	}
+	if d.maxDocumentSize > 0 && resp.ContentLength > d.maxDocumentSize {
+		return res, d.documentTooLargeError()
+	}
+
+	doc := &ld.RemoteDocument{DocumentURL: resp.Request.URL.String()}
+
+	contentType := resp.Header.Get("Content-Type")
+	linkHeader := resp.Header.Get("Link")
+
+	if len(linkHeader) > 0 {
+		parsedLinkHeader := ld.ParseLinkHeader(linkHeader)
+		contextLink := parsedLinkHeader[linkHeaderRel]
+		if contextLink != nil && contentType != ld.ApplicationJSONLDType {
+			if len(contextLink) > 1 {
+				return res, ld.NewJsonLdError(ld.MultipleContextLinkHeaders,
+					nil)
+			} else if len(contextLink) == 1 {
+				doc.ContextURL = contextLink[0]["target"]
+			}
+		}
+
+		// If content-type is not application/ld+json, nor any other +json
+		// and a link with rel=alternate and type='application/ld+json' is found,
+		// use that instead
+		alternateLink := parsedLinkHeader["alternate"]
+		if len(alternateLink) > 0 &&
+			alternateLink[0]["type"] == ld.ApplicationJSONLDType &&
+			!rApplicationJSON.MatchString(contentType) {
+
+			finalURL := ld.Resolve(u, alternateLink[0]["target"])
+			altCtx, err := d.withAlternateLink(parentCtx, finalURL)
+			if err != nil {
+				return res, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+			}
+			// the call is not coalesced to avoid deadlocks on cyclic links
+			doc, err = d.loadDocument(altCtx, finalURL)
+			if err != nil {
+				return res, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+			}
+		}
+	}
+
+	reasons, resExpireTime, err := cachecontrol.CachableResponse(req, resp,
+		cachecontrol.Options{})
+	// If there are no errors parsing cache headers and there are no
+	// reasons not to cache, then we cache
+	if err == nil && len(reasons) == 0 {
+		res.shouldCache = true
+		res.entry.ExpireTime = resExpireTime
+	}
+
+	if doc.Document == nil {
+		doc.Document, err = d.readDocument(body)
+		if err != nil {
+			return res, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+		}
+	}
+
+	res.entry.Document = doc
+	return res, nil
+}
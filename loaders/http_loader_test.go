@@ -0,0 +1,454 @@
+package loaders
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/piprate/json-gold/ld"
+	"github.com/stretchr/testify/require"
+)
+
+const testETag = `"v1"`
+
+// newEntryCache returns the memory cache with the expired entry for u
+func newEntryCache(t testing.TB, u string,
+	entry CacheEntry) EntryCacheEngine {
+
+	cache, err := NewMemoryCacheEngine()
+	require.NoError(t, err)
+	ec := cache.(EntryCacheEngine)
+
+	if entry.Document == nil {
+		entry.Document = &ld.RemoteDocument{
+			DocumentURL: u,
+			Document: map[string]any{"@context": map[string]any{
+				"name": "https://schema.org/givenName"}},
+		}
+	}
+	require.NoError(t, ec.SetEntry(u, entry))
+	return ec
+}
+
+func docContext(t testing.TB, doc *ld.RemoteDocument) string {
+	m, ok := doc.Document.(map[string]any)
+	require.True(t, ok)
+	return m["@context"].(map[string]any)["name"].(string)
+}
+
+func TestDocumentLoader_StoreValidators(t *testing.T) {
+	const lastModified = "Wed, 21 Oct 2015 07:28:00 GMT"
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", testETag)
+			w.Header().Set("Last-Modified", lastModified)
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+
+	cache, err := NewMemoryCacheEngine()
+	require.NoError(t, err)
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(cache))
+	u := srv.URL + "/context.jsonld"
+	_, err = loader.LoadDocument(u)
+	require.NoError(t, err)
+
+	entry, err := cache.(EntryCacheEngine).GetEntry(u)
+	require.NoError(t, err)
+	require.Equal(t, testETag, entry.ETag)
+	require.Equal(t, lastModified, entry.LastModified)
+	require.True(t, entry.ExpireTime.After(time.Now()))
+	require.Equal(t, entry.ExpireTime, entry.StaleUntil)
+}
+
+func TestDocumentLoader_RevalidateNotModified(t *testing.T) {
+	const lastModified = "Wed, 21 Oct 2015 07:28:00 GMT"
+	testCases := []struct {
+		name   string
+		entry  CacheEntry
+		header string
+		value  string
+	}{
+		{
+			name:   "etag",
+			entry:  CacheEntry{ETag: testETag},
+			header: "If-None-Match",
+			value:  testETag,
+		},
+		{
+			name:   "last modified",
+			entry:  CacheEntry{LastModified: lastModified},
+			header: "If-Modified-Since",
+			value:  lastModified,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&requests, 1)
+					w.Header().Set("Cache-Control", "max-age=60")
+					if r.Header.Get(tc.header) == tc.value {
+						w.WriteHeader(http.StatusNotModified)
+						return
+					}
+					_, _ = io.WriteString(w, testIPFSDoc)
+				}))
+			defer srv.Close()
+
+			u := srv.URL + "/context.jsonld"
+			tc.entry.ExpireTime = time.Now().Add(-time.Minute)
+			cache := newEntryCache(t, u, tc.entry)
+			loader := NewDocumentLoader(nil, "", WithCacheEngine(cache))
+
+			doc, err := loader.LoadDocument(u)
+			require.NoError(t, err)
+			require.Equal(t, "https://schema.org/givenName",
+				docContext(t, doc))
+
+			// the expiration is refreshed, validators are kept
+			entry, err := cache.GetEntry(u)
+			require.NoError(t, err)
+			require.True(t, entry.ExpireTime.After(time.Now()))
+			require.Equal(t, tc.entry.ETag, entry.ETag)
+			require.Equal(t, tc.entry.LastModified, entry.LastModified)
+
+			_, err = loader.LoadDocument(u)
+			require.NoError(t, err)
+			require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+		})
+	}
+}
+
+func TestDocumentLoader_RevalidateModified(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, testETag, r.Header.Get("If-None-Match"))
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", `"v2"`)
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+
+	u := srv.URL + "/context.jsonld"
+	cache := newEntryCache(t, u, CacheEntry{
+		ExpireTime: time.Now().Add(-time.Minute),
+		ETag:       testETag,
+	})
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(cache))
+
+	doc, err := loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.org/name", docContext(t, doc))
+
+	entry, err := cache.GetEntry(u)
+	require.NoError(t, err)
+	require.Equal(t, `"v2"`, entry.ETag)
+}
+
+func TestDocumentLoader_RevalidateAfterPurge(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			require.Equal(t, testETag, r.Header.Get("If-None-Match"))
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.WriteHeader(http.StatusNotModified)
+		}))
+	defer srv.Close()
+
+	// documents with validators are kept only in the bounded cache
+	cache, err := NewMemoryCacheEngine(WithMaxCacheEntries(10))
+	require.NoError(t, err)
+	u := srv.URL + "/context.jsonld"
+	require.NoError(t, cache.(EntryCacheEngine).SetEntry(u, CacheEntry{
+		Document: &ld.RemoteDocument{DocumentURL: u,
+			Document: map[string]any{"@context": map[string]any{
+				"name": "https://schema.org/givenName"}}},
+		ExpireTime: time.Now().Add(-time.Hour),
+		StaleUntil: time.Now().Add(-time.Hour),
+		ETag:       testETag,
+	}))
+	// the purge interval has passed since the document expired
+	cache.(*memoryCacheEngine).lastPurge = time.Now().Add(-time.Hour)
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(cache))
+
+	doc, err := loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.org/givenName", docContext(t, doc))
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	stats := cache.(CacheStatsReporter).Stats()
+	require.Equal(t, uint64(0), stats.Expirations)
+	require.Equal(t, 1, stats.Entries)
+}
+
+func TestDocumentLoader_StaleWhileRevalidate(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			<-release
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+
+	u := srv.URL + "/context.jsonld"
+	cache := newEntryCache(t, u, CacheEntry{
+		ExpireTime: time.Now().Add(-time.Minute),
+	})
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(cache),
+		WithStaleWhileRevalidate(time.Hour))
+
+	// the stale document is served while the server is blocked, and only
+	// one revalidation is started
+	for i := 0; i < 3; i++ {
+		doc, err := loader.LoadDocument(u)
+		require.NoError(t, err)
+		require.Equal(t, "https://schema.org/givenName", docContext(t, doc))
+	}
+	close(release)
+
+	require.Eventually(t, func() bool {
+		entry, err := cache.GetEntry(u)
+		return err == nil && entry.ExpireTime.After(time.Now())
+	}, 5*time.Second, time.Millisecond)
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	doc, err := loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.org/name", docContext(t, doc))
+
+	entry, err := cache.GetEntry(u)
+	require.NoError(t, err)
+	require.Equal(t, entry.ExpireTime.Add(time.Hour), entry.StaleUntil)
+}
+
+func TestDocumentLoader_StaleWhileRevalidateExpiredGrace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+
+	u := srv.URL + "/context.jsonld"
+	cache := newEntryCache(t, u, CacheEntry{
+		ExpireTime: time.Now().Add(-time.Hour),
+	})
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(cache),
+		WithStaleWhileRevalidate(time.Minute))
+
+	// the grace period is over, so the document is loaded synchronously
+	doc, err := loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.org/name", docContext(t, doc))
+}
+
+func TestDocumentLoader_StaleIfError(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(int(atomic.LoadInt32(&status)))
+		}))
+	defer srv.Close()
+
+	u := srv.URL + "/context.jsonld"
+	newLoader := func(expireTime time.Time) DocumentLoader {
+		cache := newEntryCache(t, u, CacheEntry{ExpireTime: expireTime})
+		return NewDocumentLoader(nil, "", WithCacheEngine(cache),
+			WithStaleIfError(10*time.Minute))
+	}
+
+	t.Run("server error", func(t *testing.T) {
+		loader := newLoader(time.Now().Add(-time.Minute))
+		doc, err := loader.LoadDocument(u)
+		require.NoError(t, err)
+		require.Equal(t, "https://schema.org/givenName", docContext(t, doc))
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		atomic.StoreInt32(&status, http.StatusNotFound)
+		defer atomic.StoreInt32(&status, http.StatusInternalServerError)
+
+		loader := newLoader(time.Now().Add(-time.Minute))
+		_, err := loader.LoadDocument(u)
+		require.EqualError(t, err,
+			"loading document failed: Bad response status code: 404")
+	})
+
+	t.Run("grace is over", func(t *testing.T) {
+		loader := newLoader(time.Now().Add(-time.Hour))
+		_, err := loader.LoadDocument(u)
+		require.EqualError(t, err,
+			"loading document failed: Bad response status code: 500")
+	})
+
+	t.Run("server is down", func(t *testing.T) {
+		srv2 := httptest.NewServer(http.NotFoundHandler())
+		u2 := srv2.URL + "/context.jsonld"
+		srv2.Close()
+
+		cache := newEntryCache(t, u2, CacheEntry{
+			ExpireTime: time.Now().Add(-time.Minute)})
+		loader := NewDocumentLoader(nil, "", WithCacheEngine(cache),
+			WithStaleIfError(10*time.Minute))
+		doc, err := loader.LoadDocument(u2)
+		require.NoError(t, err)
+		require.Equal(t, "https://schema.org/givenName", docContext(t, doc))
+	})
+}
+
+// plainCacheEngine hides the entry methods of the wrapped cache
+type plainCacheEngine struct {
+	CacheEngine
+}
+
+func TestDocumentLoader_RevalidatePlainCacheEngine(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			// validators are not stored, so the request is unconditional
+			require.Empty(t, r.Header.Get("If-None-Match"))
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", testETag)
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+
+	u := srv.URL + "/context.jsonld"
+	cache := newEntryCache(t, u, CacheEntry{
+		ExpireTime: time.Now().Add(-time.Minute),
+		ETag:       testETag,
+	})
+	loader := NewDocumentLoader(nil, "",
+		WithCacheEngine(plainCacheEngine{cache}))
+
+	doc, err := loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.org/name", docContext(t, doc))
+}
+
+func TestDocumentLoader_RefreshDocument(t *testing.T) {
+	var status int32 = http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			// the cached document is not revalidated
+			require.Empty(t, r.Header.Get("If-None-Match"))
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.WriteHeader(int(atomic.LoadInt32(&status)))
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+
+	u := srv.URL + "/context.jsonld"
+	cache := newEntryCache(t, u, CacheEntry{
+		ExpireTime: time.Now().Add(time.Hour),
+		ETag:       testETag,
+	})
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(cache))
+	refresher := loader.(DocumentRefresher)
+
+	doc, err := loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.org/givenName", docContext(t, doc))
+
+	doc, err = refresher.RefreshDocument(context.Background(), u)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.org/name", docContext(t, doc))
+	doc, err = loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.org/name", docContext(t, doc))
+
+	// the cached document is kept on errors
+	atomic.StoreInt32(&status, http.StatusInternalServerError)
+	_, err = refresher.RefreshDocument(context.Background(), u)
+	require.EqualError(t, err,
+		"loading document failed: Bad response status code: 500")
+	doc, err = loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.org/name", docContext(t, doc))
+}
+
+func TestDocumentLoader_RefreshNotCacheable(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.Header().Set("Cache-Control", "no-store")
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+
+	u := srv.URL + "/context.jsonld"
+	cache := newEntryCache(t, u, CacheEntry{
+		ExpireTime: time.Now().Add(time.Hour),
+	})
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(cache))
+
+	doc, err := loader.(DocumentRefresher).RefreshDocument(
+		context.Background(), u)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.org/name", docContext(t, doc))
+
+	// the old document is not served anymore
+	doc, err = loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.org/name", docContext(t, doc))
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+// getSetCacheEngine hides all methods of the cache engine except Get and
+// Set
+type getSetCacheEngine struct {
+	CacheEngine
+}
+
+func TestDocumentLoader_RefreshNotCacheablePlainCache(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			w.Header().Set("Cache-Control", "no-store")
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+
+	u := srv.URL + "/context.jsonld"
+	cache := getSetCacheEngine{newEntryCache(t, u, CacheEntry{
+		ExpireTime: time.Now().Add(time.Hour),
+	})}
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(cache))
+
+	_, err := loader.(DocumentRefresher).RefreshDocument(
+		context.Background(), u)
+	require.NoError(t, err)
+
+	// the old document is replaced with the expired one
+	doc, err := loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.org/name", docContext(t, doc))
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestDocumentLoader_RefreshEmbeddedDocument(t *testing.T) {
+	u := "https://example.com/context.jsonld"
+	cache, err := NewMemoryCacheEngine(
+		WithEmbeddedDocumentBytes(u, []byte(testIPFSDoc)))
+	require.NoError(t, err)
+
+	// embedded documents are not loaded even in the offline mode
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(cache),
+		WithOfflineMode())
+	doc, err := loader.(DocumentRefresher).RefreshDocument(
+		context.Background(), u)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.org/name", docContext(t, doc))
+}
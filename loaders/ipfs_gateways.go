@@ -0,0 +1,210 @@
+package loaders
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/piprate/json-gold/ld"
+)
+
+const (
+	defaultIPFSGatewayCooldown = 30 * time.Second
+
+	// the gateway is considered unhealthy after this number of consecutive
+	// failures
+	ipfsGatewayMaxFailures = 3
+)
+
+// WithIPFSGateways adds IPFS gateways that are tried in order after the
+// gateway passed to NewDocumentLoader. Unhealthy gateways are skipped until
+// their cooldown period ends.
+func WithIPFSGateways(gateways ...string) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		for _, gw := range gateways {
+			loader.ipfsGateways.add(gw)
+		}
+	}
+}
+
+// WithIPFSGatewayFallback makes the loader fall back to IPFS gateways if
+// the IPFSClient fails to load the document
+func WithIPFSGatewayFallback() DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.ipfsGatewayFallback = true
+	}
+}
+
+// WithIPFSRetries makes the loader retry loading of IPFS documents from
+// gateways if all of them fail with transient errors: network errors,
+// timeouts, 429 and 5xx responses. The first retry is made after backoff,
+// and the delay is doubled for every next retry.
+func WithIPFSRetries(retries int, backoff time.Duration) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.ipfsRetries = retries
+		loader.ipfsBackoff = backoff
+	}
+}
+
+// WithIPFSGatewayCooldown sets how long unhealthy gateways are skipped.
+// A gateway becomes unhealthy after several consecutive transient failures,
+// or at once if it responds with a document that does not match the CID.
+// Default is 30 seconds.
+func WithIPFSGatewayCooldown(cooldown time.Duration) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.ipfsGateways.cooldown = cooldown
+	}
+}
+
+// WithIPFSGatewayReport sets the function that is called with the gateway
+// URL every time an IPFS document is loaded. gateway is empty if the
+// document is loaded with the IPFSClient. Cached documents are not
+// reported.
+func WithIPFSGatewayReport(fn func(u, gateway string)) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.ipfsGatewayReport = fn
+	}
+}
+
+type ipfsGateway struct {
+	url            string
+	failures       int
+	unhealthyUntil time.Time
+}
+
+// ipfsGatewayPool tracks health of IPFS gateways
+type ipfsGatewayPool struct {
+	m        sync.Mutex
+	gateways []*ipfsGateway
+	cooldown time.Duration
+}
+
+func (p *ipfsGatewayPool) add(gw string) {
+	if gw == "" {
+		return
+	}
+	p.gateways = append(p.gateways, &ipfsGateway{url: gw})
+}
+
+func (p *ipfsGatewayPool) empty() bool {
+	return len(p.gateways) == 0
+}
+
+// healthy returns URLs of healthy gateways in order. If all gateways are
+// unhealthy, all of them are returned, as it is better to try them than to
+// fail at once.
+func (p *ipfsGatewayPool) healthy() []string {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	now := time.Now()
+	urls := make([]string, 0, len(p.gateways))
+	for _, gw := range p.gateways {
+		if gw.unhealthyUntil.Before(now) {
+			urls = append(urls, gw.url)
+		}
+	}
+	if len(urls) == 0 {
+		for _, gw := range p.gateways {
+			urls = append(urls, gw.url)
+		}
+	}
+	return urls
+}
+
+func (p *ipfsGatewayPool) get(u string) *ipfsGateway {
+	for _, gw := range p.gateways {
+		if gw.url == u {
+			return gw
+		}
+	}
+	return nil
+}
+
+func (p *ipfsGatewayPool) succeeded(u string) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if gw := p.get(u); gw != nil {
+		gw.failures = 0
+		gw.unhealthyUntil = time.Time{}
+	}
+}
+
+// failed records the failure of the gateway. If fatal is true, the gateway
+// becomes unhealthy at once.
+func (p *ipfsGatewayPool) failed(u string, fatal bool) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	gw := p.get(u)
+	if gw == nil {
+		return
+	}
+	gw.failures++
+	if fatal || gw.failures >= ipfsGatewayMaxFailures {
+		gw.unhealthyUntil = time.Now().Add(p.cooldown)
+	}
+}
+
+// loadDocumentFromIPFSGateways tries healthy gateways in order until one of
+// them serves the document, and retries transient failures with exponential
+// backoff. It returns the URL of the gateway that served the document.
+func (d *documentLoader) loadDocumentFromIPFSGateways(ctx context.Context,
+	ipfsURL string) (document any, gateway string, err error) {
+
+	backoff := d.ipfsBackoff
+	for attempt := 0; ; attempt++ {
+		transient := false
+		for _, gw := range d.ipfsGateways.healthy() {
+			document, err = d.loadDocumentFromIPFSGW(ctx, gw, ipfsURL)
+			if err == nil {
+				d.ipfsGateways.succeeded(gw)
+				return document, gw, nil
+			}
+
+			switch {
+			case ctx.Err() != nil,
+				errors.Is(err, ErrIPFSDocumentUnverifiable),
+				errors.Is(err, ErrDocumentTooLarge):
+
+				// other gateways would fail the same way
+				return nil, "", err
+			case errors.Is(err, ErrIPFSDocumentMismatch):
+				d.ipfsGateways.failed(gw, true)
+			case isTransientError(ctx, err):
+				d.ipfsGateways.failed(gw, false)
+				transient = true
+			}
+			// other errors, e.g. 404 or the broken response, may be caused
+			// by the gateway, so the next one is tried
+		}
+
+		if !transient || attempt >= d.ipfsRetries {
+			return nil, "", err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, "", ld.NewJsonLdError(ld.LoadingDocumentFailed,
+				ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// isTransientError reports if the request may succeed when retried
+func isTransientError(ctx context.Context, err error) bool {
+	var statusErr badStatusError
+	if errors.As(err, &statusErr) &&
+		statusErr.statusCode == http.StatusTooManyRequests {
+
+		return ctx.Err() == nil
+	}
+	return isOriginError(ctx, err)
+}
@@ -0,0 +1,202 @@
+package loaders
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testGateway struct {
+	*httptest.Server
+	requests int32
+}
+
+// newTestGateway starts the gateway that responds with the status returned
+// by status for the n-th request, starting from 1
+func newTestGateway(t testing.TB, status func(n int32) int) *testGateway {
+	gw := &testGateway{}
+	gw.Server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			st := status(atomic.AddInt32(&gw.requests, 1))
+			if st != http.StatusOK {
+				w.WriteHeader(st)
+				return
+			}
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	t.Cleanup(gw.Close)
+	return gw
+}
+
+func (gw *testGateway) Requests() int32 {
+	return atomic.LoadInt32(&gw.requests)
+}
+
+func alwaysStatus(status int) func(int32) int {
+	return func(int32) int { return status }
+}
+
+type gatewayReport struct {
+	reports []string
+}
+
+func (r *gatewayReport) option() DocumentLoaderOption {
+	return WithIPFSGatewayReport(func(u, gateway string) {
+		r.reports = append(r.reports, gateway)
+	})
+}
+
+func TestDocumentLoader_IPFSGatewaysFallback(t *testing.T) {
+	gw1 := newTestGateway(t, alwaysStatus(http.StatusBadGateway))
+	gw2 := newTestGateway(t, alwaysStatus(http.StatusTooManyRequests))
+	gw3 := newTestGateway(t, alwaysStatus(http.StatusOK))
+
+	var report gatewayReport
+	loader := NewDocumentLoader(nil, gw1.URL, WithCacheEngine(nil),
+		WithIPFSGateways(gw2.URL, gw3.URL), report.option())
+	doc, err := loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, testIPFSURL, doc.DocumentURL)
+	require.Equal(t, []string{gw3.URL}, report.reports)
+	require.Equal(t, int32(1), gw1.Requests())
+	require.Equal(t, int32(1), gw2.Requests())
+}
+
+func TestDocumentLoader_IPFSGatewaysNotFound(t *testing.T) {
+	gw1 := newTestGateway(t, alwaysStatus(http.StatusNotFound))
+	gw2 := newTestGateway(t, alwaysStatus(http.StatusOK))
+
+	// the error is not transient, so it is not retried, but the next
+	// gateway is tried
+	loader := NewDocumentLoader(nil, gw1.URL, WithCacheEngine(nil),
+		WithIPFSGateways(gw2.URL), WithIPFSRetries(3, time.Millisecond))
+	_, err := loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), gw1.Requests())
+	require.Equal(t, int32(1), gw2.Requests())
+
+	// the gateway is not marked unhealthy
+	_, err = loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), gw1.Requests())
+
+	loader = NewDocumentLoader(nil, gw1.URL, WithCacheEngine(nil),
+		WithIPFSRetries(3, time.Millisecond))
+	_, err = loader.LoadDocument(testIPFSURL)
+	require.EqualError(t, err,
+		"loading document failed: Bad response status code: 404")
+	require.Equal(t, int32(3), gw1.Requests())
+}
+
+func TestDocumentLoader_IPFSRetries(t *testing.T) {
+	// fails twice and then succeeds
+	gw := newTestGateway(t, func(n int32) int {
+		if n <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+
+	loader := NewDocumentLoader(nil, gw.URL, WithCacheEngine(nil),
+		WithIPFSRetries(1, time.Millisecond))
+	_, err := loader.LoadDocument(testIPFSURL)
+	require.EqualError(t, err,
+		"loading document failed: Bad response status code: 503")
+	require.Equal(t, int32(2), gw.Requests())
+
+	loader = NewDocumentLoader(nil, gw.URL, WithCacheEngine(nil),
+		WithIPFSRetries(1, time.Millisecond))
+	_, err = loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), gw.Requests())
+}
+
+func TestDocumentLoader_IPFSRetriesCanceled(t *testing.T) {
+	gw := newTestGateway(t, alwaysStatus(http.StatusServiceUnavailable))
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+	loader := NewDocumentLoader(nil, gw.URL, WithCacheEngine(nil),
+		WithIPFSRetries(10, time.Hour))
+	_, err := loader.LoadDocumentWithContext(ctx, testIPFSURL)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, int32(1), gw.Requests())
+}
+
+func TestDocumentLoader_IPFSUnhealthyGateway(t *testing.T) {
+	gw1 := newTestGateway(t, alwaysStatus(http.StatusInternalServerError))
+	gw2 := newTestGateway(t, alwaysStatus(http.StatusOK))
+
+	const cooldown = 100 * time.Millisecond
+	loader := NewDocumentLoader(nil, gw1.URL, WithCacheEngine(nil),
+		WithIPFSGateways(gw2.URL), WithIPFSGatewayCooldown(cooldown))
+	for i := 0; i < ipfsGatewayMaxFailures+2; i++ {
+		_, err := loader.LoadDocument(testIPFSURL)
+		require.NoError(t, err)
+	}
+	// the gateway is skipped after it becomes unhealthy
+	require.Equal(t, int32(ipfsGatewayMaxFailures), gw1.Requests())
+
+	time.Sleep(cooldown)
+	_, err := loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, int32(ipfsGatewayMaxFailures+1), gw1.Requests())
+
+	// if all gateways are unhealthy, they are tried anyway
+	loader = NewDocumentLoader(nil, gw1.URL, WithCacheEngine(nil))
+	for i := 0; i < ipfsGatewayMaxFailures+1; i++ {
+		_, err = loader.LoadDocument(testIPFSURL)
+		require.Error(t, err)
+	}
+	require.Equal(t, int32(2*ipfsGatewayMaxFailures+2), gw1.Requests())
+}
+
+func TestDocumentLoader_IPFSMismatchedGateway(t *testing.T) {
+	tampered := newIPFSGateway(t, true)
+	gw := newIPFSGateway(t, false)
+
+	var report gatewayReport
+	loader := NewDocumentLoader(nil, tampered.URL, WithCacheEngine(nil),
+		WithIPFSGateways(gw.URL), WithIPFSGatewayVerification(),
+		report.option())
+	for i := 0; i < 2; i++ {
+		_, err := loader.LoadDocument("ipfs://" + testRawCID)
+		require.NoError(t, err)
+	}
+	require.Equal(t, []string{gw.URL, gw.URL}, report.reports)
+
+	// the tampered gateway is unhealthy after the first mismatch
+	pool := &loader.(*documentLoader).ipfsGateways
+	require.Equal(t, []string{gw.URL}, pool.healthy())
+}
+
+func TestDocumentLoader_IPFSNodeFallback(t *testing.T) {
+	gw := newTestGateway(t, alwaysStatus(http.StatusOK))
+	ipfsCli := &mockIPFSClient{}
+
+	loader := NewDocumentLoader(ipfsCli, gw.URL, WithCacheEngine(nil))
+	_, err := loader.LoadDocument(testIPFSURL)
+	require.Error(t, err)
+	require.Equal(t, int32(0), gw.Requests())
+
+	var report gatewayReport
+	loader = NewDocumentLoader(ipfsCli, gw.URL, WithCacheEngine(nil),
+		WithIPFSGatewayFallback(), report.option())
+	_, err = loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, []string{gw.URL}, report.reports)
+
+	// the document from the node is reported with empty gateway
+	ipfsCli.docs = map[string]string{
+		testIPFSURL[len(ipfsPrefix):]: testIPFSDoc}
+	_, err = loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, []string{gw.URL, ""}, report.reports)
+}
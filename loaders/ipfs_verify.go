@@ -0,0 +1,346 @@
+package loaders
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mr-tron/base58"
+	"github.com/piprate/json-gold/ld"
+)
+
+const (
+	cidCodecRaw   = 0x55
+	cidCodecDagPB = 0x70
+
+	multihashSHA2256 = 0x12
+	multihashSHA2512 = 0x13
+
+	unixFSTypeRaw  = 0
+	unixFSTypeFile = 2
+
+	// IPFS nodes do not exchange blocks larger than this
+	maxIPFSBlockSize = 2 << 20
+)
+
+var (
+	// ErrIPFSDocumentUnverifiable is returned in strict verification mode
+	// for documents from the IPFS gateway that can't be verified against
+	// their CID, e.g. documents addressed by path or split into several
+	// blocks
+	ErrIPFSDocumentUnverifiable = errors.New(
+		"IPFS document can't be verified")
+	// ErrIPFSDocumentMismatch is returned if the IPFS gateway responds with
+	// the content that does not match the CID
+	ErrIPFSDocumentMismatch = errors.New("IPFS document does not match CID")
+)
+
+var errInvalidProtobuf = errors.New("invalid protobuf message")
+
+var multihashes = map[uint64]func() hash.Hash{
+	multihashSHA2256: sha256.New,
+	multihashSHA2512: sha512.New,
+}
+
+// WithIPFSGatewayVerification makes the loader request raw blocks from the
+// IPFS gateway and verify them against their CIDs, so a malicious gateway
+// can't substitute documents. Raw and single-block dag-pb (UnixFS) documents
+// are verified, other documents are loaded from the gateway unverified.
+func WithIPFSGatewayVerification() DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.verifyIPFSGW = true
+	}
+}
+
+// WithStrictIPFSGatewayVerification is like WithIPFSGatewayVerification,
+// but documents that can't be verified are rejected with
+// ErrIPFSDocumentUnverifiable.
+func WithStrictIPFSGatewayVerification() DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.verifyIPFSGW = true
+		loader.strictIPFSGW = true
+	}
+}
+
+type cid struct {
+	codec    uint64
+	hashCode uint64
+	digest   []byte
+}
+
+func parseCID(s string) (cid, error) {
+	var c cid
+
+	// CIDv0 is the base58 encoded sha2-256 multihash of a dag-pb block
+	if len(s) == 46 && strings.HasPrefix(s, "Qm") {
+		mh, err := base58.Decode(s)
+		if err != nil {
+			return c, err
+		}
+		c.codec = cidCodecDagPB
+		c.hashCode, c.digest, err = parseMultihash(mh)
+		return c, err
+	}
+
+	if s == "" {
+		return c, errors.New("empty CID")
+	}
+	var b []byte
+	var err error
+	switch s[0] {
+	case 'b':
+		b, err = base32.StdEncoding.WithPadding(base32.NoPadding).
+			DecodeString(strings.ToUpper(s[1:]))
+	case 'B':
+		b, err = base32.StdEncoding.WithPadding(base32.NoPadding).
+			DecodeString(s[1:])
+	case 'z':
+		b, err = base58.Decode(s[1:])
+	case 'f', 'F':
+		b, err = hex.DecodeString(s[1:])
+	default:
+		return c, fmt.Errorf("unsupported multibase encoding: %c", s[0])
+	}
+	if err != nil {
+		return c, err
+	}
+
+	version, n := binary.Uvarint(b)
+	if n <= 0 || version != 1 {
+		return c, errors.New("unsupported CID version")
+	}
+	b = b[n:]
+
+	c.codec, n = binary.Uvarint(b)
+	if n <= 0 {
+		return c, errors.New("invalid CID codec")
+	}
+
+	c.hashCode, c.digest, err = parseMultihash(b[n:])
+	return c, err
+}
+
+func parseMultihash(mh []byte) (code uint64, digest []byte, err error) {
+	code, n := binary.Uvarint(mh)
+	if n <= 0 {
+		return 0, nil, errors.New("invalid multihash")
+	}
+	mh = mh[n:]
+
+	length, n := binary.Uvarint(mh)
+	if n <= 0 || length != uint64(len(mh)-n) {
+		return 0, nil, errors.New("invalid multihash length")
+	}
+	return code, mh[n:], nil
+}
+
+func unverifiableError(format string, args ...any) error {
+	return ld.NewJsonLdError(ld.LoadingDocumentFailed,
+		fmt.Errorf("%w: "+format,
+			append([]any{ErrIPFSDocumentUnverifiable}, args...)...))
+}
+
+// loadVerifiedDocumentFromIPFSGW loads the raw block of the document from the
+// gateway and verifies it against the CID
+func (d *documentLoader) loadVerifiedDocumentFromIPFSGW(ctx context.Context,
+	gw, ipfsURL string) (any, error) {
+
+	cidStr, path, _ := strings.Cut(strings.TrimLeft(ipfsURL, "/"), "/")
+	if path != "" {
+		return nil, unverifiableError("document is addressed by path: %v",
+			ipfsURL)
+	}
+
+	c, err := parseCID(cidStr)
+	if err != nil {
+		return nil, unverifiableError("%v: %v", cidStr, err)
+	}
+	newHash, ok := multihashes[c.hashCode]
+	if !ok {
+		return nil, unverifiableError("unsupported hash function 0x%x: %v",
+			c.hashCode, cidStr)
+	}
+	if c.codec != cidCodecRaw && c.codec != cidCodecDagPB {
+		return nil, unverifiableError("unsupported codec 0x%x: %v", c.codec,
+			cidStr)
+	}
+
+	block, err := d.fetchIPFSBlock(ctx, gw, cidStr)
+	if err != nil {
+		return nil, err
+	}
+
+	h := newHash()
+	h.Write(block)
+	if !bytes.Equal(h.Sum(nil), c.digest) {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed,
+			fmt.Errorf("%w: %v", ErrIPFSDocumentMismatch, cidStr))
+	}
+
+	content := block
+	if c.codec == cidCodecDagPB {
+		content, err = unixFSFileContent(block)
+		if err != nil {
+			return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed,
+				fmt.Errorf("%v: %w", cidStr, err))
+		}
+	}
+
+	return d.readDocument(bytes.NewReader(content))
+}
+
+func (d *documentLoader) fetchIPFSBlock(ctx context.Context,
+	gw, cidStr string) (block []byte, err error) {
+
+	// custom transports may ignore the context of the request
+	if err := ctx.Err(); err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+
+	blockURL := ipfsGatewayURL(gw, cidStr) + "?format=raw"
+	var statusCode int
+	body := &countingReader{}
+	obs := d.startFetch(FetchSourceIPFSGateway, blockURL)
+	defer func() { obs.finish(statusCode, body.n, err) }()
+
+	ctx, cancel := d.withRequestTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, blockURL,
+		http.NoBody)
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+	req.Header.Set("Accept", "application/vnd.ipld.raw")
+
+	httpClient := d.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	statusCode = resp.StatusCode
+	body.r = resp.Body
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed,
+			badStatusError{resp.StatusCode})
+	}
+
+	lr := &io.LimitedReader{R: body, N: maxIPFSBlockSize + 1}
+	block, err = io.ReadAll(lr)
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+	if lr.N <= 0 {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed,
+			fmt.Errorf("%w: limit of IPFS block is %d bytes",
+				ErrDocumentTooLarge, maxIPFSBlockSize))
+	}
+	return block, nil
+}
+
+// unixFSFileContent returns the content of the file stored in the single
+// dag-pb block
+func unixFSFileContent(block []byte) ([]byte, error) {
+	var unixFSData []byte
+	err := protoFields(block, func(field uint64, value []byte, _ uint64) error {
+		switch field {
+		case 1: // PBNode.Data
+			unixFSData = value
+		case 2: // PBNode.Links
+			return fmt.Errorf("%w: document is split into several blocks",
+				ErrIPFSDocumentUnverifiable)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fileType := uint64(unixFSTypeRaw)
+	var content []byte
+	err = protoFields(unixFSData,
+		func(field uint64, value []byte, num uint64) error {
+			switch field {
+			case 1: // Data.Type
+				fileType = num
+			case 2: // Data.Data
+				content = value
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	if fileType != unixFSTypeRaw && fileType != unixFSTypeFile {
+		return nil, fmt.Errorf("%w: UnixFS node of type %d is not a file",
+			ErrIPFSDocumentUnverifiable, fileType)
+	}
+	return content, nil
+}
+
+// protoFields calls fn for every field of the protobuf message. value is
+// the payload of length-delimited fields and num is the value of varint
+// fields.
+func protoFields(msg []byte,
+	fn func(field uint64, value []byte, num uint64) error) error {
+
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errInvalidProtobuf
+		}
+		msg = msg[n:]
+
+		var value []byte
+		var num uint64
+		switch key & 7 {
+		case 0: // varint
+			num, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return errInvalidProtobuf
+			}
+			msg = msg[n:]
+		case 1: // 64-bit
+			if len(msg) < 8 {
+				return errInvalidProtobuf
+			}
+			msg = msg[8:]
+		case 2: // length-delimited
+			length, n := binary.Uvarint(msg)
+			if n <= 0 || length > uint64(len(msg)-n) {
+				return errInvalidProtobuf
+			}
+			value = msg[n : n+int(length)]
+			msg = msg[n+int(length):]
+		case 5: // 32-bit
+			if len(msg) < 4 {
+				return errInvalidProtobuf
+			}
+			msg = msg[4:]
+		default:
+			return errInvalidProtobuf
+		}
+
+		err := fn(key>>3, value, num)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
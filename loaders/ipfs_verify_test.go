@@ -0,0 +1,150 @@
+package loaders
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fixture blocks of testdata/ipfs/document.json
+const (
+	testRawCID        = "bafkreiaumwbwrt4qbeg4gzbjorjstsylenlsdtmryhxf7lyiwjlen7xspa"
+	testDagPBCIDv0    = "QmPtmSrFF2AQ2ZQgmmvJPG8LLn3cZxnNkAY5xEYiqhoqdw"
+	testDagPBCIDv1    = "bafybeiaxcxr6xdwxb3z4in23hvhaf3dla7be6v7mejf4vfkjd4cerhslry"
+	testMultiBlockCID = "QmU15ijMM2eb26bQcgNd6R6zeSvd5PtHEbVjTy5d15kx6K"
+)
+
+// testIPFSBlocks maps CIDs to fixture blocks, CIDv0 and CIDv1 of the dag-pb
+// document address the same block
+var testIPFSBlocks = map[string]string{
+	testRawCID:        testRawCID,
+	testDagPBCIDv0:    testDagPBCIDv0,
+	testDagPBCIDv1:    testDagPBCIDv0,
+	testMultiBlockCID: testMultiBlockCID,
+}
+
+// newIPFSGateway serves fixture blocks for raw block requests and the
+// document for other requests. If tampered is true, another document is
+// returned instead of blocks.
+func newIPFSGateway(t testing.TB, tampered bool) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			cidStr, _, _ := strings.Cut(
+				strings.TrimPrefix(r.URL.Path, "/ipfs/"), "/")
+
+			fName := "testdata/ipfs/document.json"
+			if r.URL.Query().Get("format") == "raw" {
+				require.Equal(t, "application/vnd.ipld.raw",
+					r.Header.Get("Accept"))
+				block, ok := testIPFSBlocks[cidStr]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if tampered {
+					_, _ = io.WriteString(w, testIPFSDoc)
+					return
+				}
+				fName = "testdata/ipfs/" + block + ".bin"
+			}
+			http.ServeFile(w, r, fName)
+		}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testIPFSDocument(t testing.TB) any {
+	docBytes, err := os.ReadFile("testdata/ipfs/document.json")
+	require.NoError(t, err)
+	var doc any
+	require.NoError(t, json.Unmarshal(docBytes, &doc))
+	return doc
+}
+
+func TestParseCID(t *testing.T) {
+	c, err := parseCID(testRawCID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(cidCodecRaw), c.codec)
+	require.Equal(t, uint64(multihashSHA2256), c.hashCode)
+	require.Len(t, c.digest, 32)
+
+	c0, err := parseCID(testDagPBCIDv0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(cidCodecDagPB), c0.codec)
+
+	c1, err := parseCID(testDagPBCIDv1)
+	require.NoError(t, err)
+	require.Equal(t, c0, c1)
+
+	// the same CIDv1 in base16
+	c1, err = parseCID(
+		"f017012201715e3eb8ed70ef3c4375b3d4e02ec6b07c24f57ec224bca954" +
+			"91f04489e4b8e")
+	require.NoError(t, err)
+	require.Equal(t, c0, c1)
+
+	for _, s := range []string{"", "Qm", "xabc", "bafy", testRawCID[:20]} {
+		_, err = parseCID(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestDocumentLoader_IPFSGatewayVerification(t *testing.T) {
+	gw := newIPFSGateway(t, false)
+	wantDoc := testIPFSDocument(t)
+
+	for _, c := range []string{testRawCID, testDagPBCIDv0, testDagPBCIDv1} {
+		for _, opt := range []DocumentLoaderOption{
+			WithIPFSGatewayVerification(),
+			WithStrictIPFSGatewayVerification(),
+		} {
+			loader := NewDocumentLoader(nil, gw.URL, WithCacheEngine(nil),
+				opt)
+			doc, err := loader.LoadDocument("ipfs://" + c)
+			require.NoError(t, err, c)
+			require.Equal(t, "ipfs://"+c, doc.DocumentURL)
+			require.Equal(t, wantDoc, doc.Document)
+		}
+	}
+}
+
+func TestDocumentLoader_IPFSGatewayMismatch(t *testing.T) {
+	gw := newIPFSGateway(t, true)
+
+	for _, c := range []string{testRawCID, testDagPBCIDv0} {
+		loader := NewDocumentLoader(nil, gw.URL, WithCacheEngine(nil),
+			WithIPFSGatewayVerification())
+		_, err := loader.LoadDocument("ipfs://" + c)
+		require.ErrorIs(t, err, ErrIPFSDocumentMismatch, c)
+	}
+}
+
+func TestDocumentLoader_IPFSGatewayUnverifiable(t *testing.T) {
+	gw := newIPFSGateway(t, false)
+	gw2 := newTestGateway(t, alwaysStatus(http.StatusOK))
+	wantDoc := testIPFSDocument(t)
+
+	for _, u := range []string{
+		"ipfs://" + testDagPBCIDv0 + "/document.json",
+		"ipfs://" + testMultiBlockCID,
+	} {
+		loader := NewDocumentLoader(nil, gw.URL, WithCacheEngine(nil),
+			WithIPFSGatewayVerification())
+		doc, err := loader.LoadDocument(u)
+		require.NoError(t, err, u)
+		require.Equal(t, wantDoc, doc.Document)
+
+		// other gateways would return the same document
+		loader = NewDocumentLoader(nil, gw.URL, WithCacheEngine(nil),
+			WithStrictIPFSGatewayVerification(), WithIPFSGateways(gw2.URL))
+		_, err = loader.LoadDocument(u)
+		require.ErrorIs(t, err, ErrIPFSDocumentUnverifiable, u)
+	}
+	require.Equal(t, int32(0), gw2.Requests())
+}
@@ -0,0 +1,195 @@
+package loaders
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/piprate/json-gold/ld"
+)
+
+const (
+	filePrefix = "file://"
+	dataPrefix = "data:"
+)
+
+// WithFileURLs enables loading of file:// URLs, e.g. to point @context at
+// local files during schema development. Only files inside the root
+// directory may be loaded, other paths are rejected with ErrURLNotAllowed.
+// Symbolic links are resolved before the check. Cached files are reloaded
+// when their modification time changes, if the cache engine implements
+// EntryCacheEngine.
+func WithFileURLs(root string) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.fileRoot = root
+	}
+}
+
+// WithDataURLs enables loading of documents inlined into data: URLs, e.g.
+// data:application/ld+json;base64,eyJAY29udGV4dCI6e319. The media type
+// must be JSON or omitted. The documents are not cached.
+func WithDataURLs() DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.dataURLs = true
+	}
+}
+
+func (d *documentLoader) loadDocumentFromFile(ctx context.Context,
+	u, src string) (*ld.RemoteDocument, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+
+	name, err := d.resolveFileURL(src)
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+	modTime := fi.ModTime().UTC().Format(time.RFC3339Nano)
+
+	cached, found, err := d.cacheEntry(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if found && cached.LastModified == modTime {
+		d.observeCache(u, true)
+		return cached.Document, nil
+	}
+	d.observeCache(u, false)
+
+	if d.maxDocumentSize > 0 && fi.Size() > d.maxDocumentSize {
+		return nil, d.documentTooLargeError()
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	doc := &ld.RemoteDocument{DocumentURL: u}
+	doc.Document, err = d.readDocument(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// the file is checked for modifications on every load, so the entry
+	// never expires
+	if d.cacheEngine != nil {
+		err = d.setCacheEntry(u, CacheEntry{
+			Document:     doc,
+			ExpireTime:   noExpireTime,
+			LastModified: modTime,
+		})
+		if err != nil {
+			return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// resolveFileURL returns the path of the file:// URL if it is inside the
+// root directory
+func (d *documentLoader) resolveFileURL(u string) (string, error) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	if pu.Host != "" && pu.Host != "localhost" {
+		return "", fmt.Errorf("%w: remote file %v", ErrURLNotAllowed, u)
+	}
+
+	root, err := filepath.Abs(d.fileRoot)
+	if err != nil {
+		return "", err
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+
+	name, err := filepath.EvalSymlinks(filepath.FromSlash(pu.Path))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, name)
+	if err != nil || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+
+		return "", fmt.Errorf("%w: %v is outside of %v", ErrURLNotAllowed,
+			u, d.fileRoot)
+	}
+	return name, nil
+}
+
+func (d *documentLoader) loadDocumentFromData(_ context.Context,
+	u, src string) (*ld.RemoteDocument, error) {
+
+	// the document is not cached, parsing it is cheap and URLs of
+	// untrusted documents would fill the cache
+	content, err := parseDataURL(src)
+	if err != nil {
+		return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, err)
+	}
+
+	doc := &ld.RemoteDocument{DocumentURL: u}
+	doc.Document, err = d.readDocument(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// parseDataURL returns the content of the data: URL with JSON media type as
+// defined in RFC 2397
+func parseDataURL(u string) ([]byte, error) {
+	header, data, ok := strings.Cut(u[len(dataPrefix):], ",")
+	if !ok {
+		return nil, errors.New("invalid data URL: missing comma")
+	}
+
+	isBase64 := false
+	if h := strings.TrimSuffix(header, ";base64"); h != header {
+		header = h
+		isBase64 = true
+	}
+	if header != "" && !strings.HasPrefix(header, ";") {
+		mediaType, _, err := mime.ParseMediaType(header)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data URL: %w", err)
+		}
+		if !rApplicationJSON.MatchString(mediaType) {
+			return nil, fmt.Errorf("unsupported media type of data URL: %v",
+				mediaType)
+		}
+	}
+
+	data, err := url.PathUnescape(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data URL: %w", err)
+	}
+	if !isBase64 {
+		return []byte(data), nil
+	}
+
+	// padding is optional
+	content, err := base64.RawStdEncoding.DecodeString(
+		strings.TrimRight(data, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid data URL: %w", err)
+	}
+	return content, nil
+}
@@ -0,0 +1,150 @@
+package loaders
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testLocalDoc = `{"@context":{"name":"http://schema.org/name"}}`
+
+func fileURL(name string) string {
+	return "file://" + filepath.ToSlash(name)
+}
+
+func TestDocumentLoader_FileURLs(t *testing.T) {
+	root := t.TempDir()
+	name := filepath.Join(root, "context.jsonld")
+	require.NoError(t, os.WriteFile(name, []byte(testLocalDoc), 0o600))
+	u := fileURL(name)
+
+	_, err := NewDocumentLoader(nil, "").LoadDocument(u)
+	require.EqualError(t, err,
+		"loading document failed: unsupported URL schema")
+
+	cacheEngine, err := NewMemoryCacheEngine()
+	require.NoError(t, err)
+	loader := NewDocumentLoader(nil, "", WithFileURLs(root),
+		WithCacheEngine(cacheEngine))
+	doc, err := loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, u, doc.DocumentURL)
+	require.Equal(t,
+		map[string]any{"@context": map[string]any{
+			"name": "http://schema.org/name"}},
+		doc.Document)
+
+	doc, err = loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1),
+		cacheEngine.(CacheStatsReporter).Stats().Hits)
+
+	// modified file is reloaded
+	require.NoError(t, os.WriteFile(name, []byte(`{"@context":{}}`), 0o600))
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(name, modTime, modTime))
+	doc, err = loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"@context": map[string]any{}},
+		doc.Document)
+
+	_, err = loader.LoadDocument(
+		fileURL(filepath.Join(root, "missing.json")))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = loader.LoadDocument(
+		"file://example.com" + filepath.ToSlash(name))
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+
+	loader = NewDocumentLoader(nil, "", WithFileURLs(root),
+		WithDeniedSchemes("file"))
+	_, err = loader.LoadDocument(u)
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+
+	loader = NewDocumentLoader(nil, "", WithFileURLs(root),
+		WithMaxDocumentSize(10))
+	_, err = loader.LoadDocument(u)
+	require.ErrorIs(t, err, ErrDocumentTooLarge)
+}
+
+func TestDocumentLoader_FileURLsOutsideRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	require.NoError(t, os.Mkdir(root, 0o700))
+	outside := filepath.Join(dir, "secret.json")
+	require.NoError(t, os.WriteFile(outside, []byte(testLocalDoc), 0o600))
+
+	loader := NewDocumentLoader(nil, "", WithFileURLs(root))
+	for _, u := range []string{
+		fileURL(outside),
+		fileURL(root) + "/../secret.json",
+	} {
+		_, err := loader.LoadDocument(u)
+		require.ErrorIs(t, err, ErrURLNotAllowed, u)
+	}
+
+	link := filepath.Join(root, "link.json")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Skipf("can't create symlink: %v", err)
+	}
+	_, err := loader.LoadDocument(fileURL(link))
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+}
+
+func TestDocumentLoader_DataURLs(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte(testLocalDoc))
+	u := "data:application/ld+json;base64," + encoded
+
+	_, err := NewDocumentLoader(nil, "").LoadDocument(u)
+	require.EqualError(t, err,
+		"loading document failed: unsupported URL schema")
+
+	cacheEngine, err := NewMemoryCacheEngine()
+	require.NoError(t, err)
+	loader := NewDocumentLoader(nil, "", WithDataURLs(),
+		WithCacheEngine(cacheEngine))
+	wantDoc := map[string]any{"@context": map[string]any{
+		"name": "http://schema.org/name"}}
+	for _, u := range []string{
+		u,
+		"data:application/json;base64," + encoded,
+		"data:;base64," + strings.TrimRight(encoded, "="),
+		"data:application/ld+json;charset=utf-8," + testLocalDoc,
+		"data:,%7B%22%40context%22%3A%7B%22name%22%3A" +
+			"%22http%3A%2F%2Fschema.org%2Fname%22%7D%7D",
+	} {
+		doc, err := loader.LoadDocument(u)
+		require.NoError(t, err, u)
+		require.Equal(t, u, doc.DocumentURL)
+		require.Equal(t, wantDoc, doc.Document, u)
+	}
+
+	// data: URLs are not cached
+	_, err = loader.LoadDocument(u)
+	require.NoError(t, err)
+	stats := cacheEngine.(CacheStatsReporter).Stats()
+	require.Equal(t, 0, stats.Entries)
+	require.Equal(t, uint64(0), stats.Hits)
+
+	for u, wantErr := range map[string]string{
+		"data:text/plain," + testLocalDoc: "loading document failed: " +
+			"unsupported media type of data URL: text/plain",
+		"data:application/json;base64": "loading document failed: " +
+			"invalid data URL: missing comma",
+		"data:;base64,!!!": "loading document failed: " +
+			"invalid data URL: illegal base64 data at input byte 0",
+	} {
+		_, err = loader.LoadDocument(u)
+		require.EqualError(t, err, wantErr, u)
+	}
+
+	loader = NewDocumentLoader(nil, "", WithDataURLs(),
+		WithAllowedSchemes("https"))
+	_, err = loader.LoadDocument(u)
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+}
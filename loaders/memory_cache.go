@@ -1,47 +1,114 @@
 package loaders
 
 import (
+	"container/list"
 	"encoding/json"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/piprate/json-gold/ld"
 )
 
+const defaultCachePurgeInterval = time.Minute
+
+// CacheStats are counters of the cache engine
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// Evictions is the number of documents removed to fit into the cache
+	// limits
+	Evictions uint64
+	// Expirations is the number of expired documents removed by purging
+	Expirations uint64
+	// Entries is the number of cached documents, embedded documents are not
+	// counted
+	Entries int
+	// Bytes is the approximate size of cached documents encoded as JSON. It
+	// is counted only if WithMaxCacheBytes is set.
+	Bytes int64
+}
+
+// CacheStatsReporter is implemented by cache engines that collect
+// statistics
+type CacheStatsReporter interface {
+	Stats() CacheStats
+}
+
 type cachedRemoteDocument struct {
-	remoteDocument *ld.RemoteDocument
-	expireTime     time.Time
+	key   string
+	entry CacheEntry
+	size  int64
 }
 
 type memoryCacheEngine struct {
-	m         sync.RWMutex
-	cache     map[string]*cachedRemoteDocument
+	m     sync.Mutex
+	cache map[string]*list.Element
+	// list of *cachedRemoteDocument, the most recently used is at the front
+	lru       *list.List
 	embedDocs map[string]*ld.RemoteDocument
+
+	maxEntries    int
+	maxBytes      int64
+	purgeInterval time.Duration
+	lastPurge     time.Time
+	now           func() time.Time
+
+	stats CacheStats
 }
 
 func (m *memoryCacheEngine) Get(
 	key string) (*ld.RemoteDocument, time.Time, error) {
 
-	if m.embedDocs != nil {
-		doc, ok := m.embedDocs[key]
-		if ok {
-			return doc, time.Now().Add(time.Hour), nil
-		}
-	}
+	entry, err := m.GetEntry(key)
+	return entry.Document, entry.ExpireTime, err
+}
+
+func (m *memoryCacheEngine) GetEntry(key string) (CacheEntry, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
 
-	m.m.RLock()
-	defer m.m.RUnlock()
+	now := m.now()
+	m.maybePurge(now)
+
+	if entry, ok := m.embeddedEntryAt(key, now); ok {
+		m.stats.Hits++
+		return entry, nil
+	}
 
-	cd, ok := m.cache[key]
-	if ok {
-		return cd.remoteDocument, cd.expireTime, nil
+	el, ok := m.cache[key]
+	if !ok {
+		m.stats.Misses++
+		return CacheEntry{}, ErrCacheMiss
 	}
-	return nil, time.Time{}, ErrCacheMiss
+
+	m.stats.Hits++
+	m.lru.MoveToFront(el)
+	return el.Value.(*cachedRemoteDocument).entry, nil
 }
 
 func (m *memoryCacheEngine) Set(key string, doc *ld.RemoteDocument,
 	expireTime time.Time) error {
 
+	return m.SetEntry(key, CacheEntry{Document: doc, ExpireTime: expireTime})
+}
+
+func (m *memoryCacheEngine) embeddedEntry(key string) (CacheEntry, bool) {
+	return m.embeddedEntryAt(key, m.now())
+}
+
+// embeddedEntryAt returns the embedded document, it is always fresh
+func (m *memoryCacheEngine) embeddedEntryAt(key string,
+	now time.Time) (CacheEntry, bool) {
+
+	doc, ok := m.embedDocs[key]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	return CacheEntry{Document: doc, ExpireTime: now.Add(time.Hour)}, true
+}
+
+func (m *memoryCacheEngine) SetEntry(key string, entry CacheEntry) error {
 	if m.embedDocs != nil {
 		// if we have the document in the embedded cache, do not overwrite it
 		// with the new value.
@@ -51,17 +118,161 @@ func (m *memoryCacheEngine) Set(key string, doc *ld.RemoteDocument,
 		}
 	}
 
+	// the size is only needed to enforce the limit, so documents are not
+	// encoded without it
+	var size int64
+	if m.maxBytes > 0 {
+		var err error
+		size, err = documentSize(key, entry.Document)
+		if err != nil {
+			return err
+		}
+	}
+
 	m.m.Lock()
 	defer m.m.Unlock()
 
-	m.cache[key] = &cachedRemoteDocument{
-		remoteDocument: doc,
-		expireTime:     expireTime,
+	m.maybePurge(m.now())
+
+	if el, ok := m.cache[key]; ok {
+		m.remove(el)
+	}
+
+	if m.maxBytes > 0 && size > m.maxBytes {
+		// the document would evict everything else and still not fit
+		m.stats.Evictions++
+		return nil
+	}
+
+	m.cache[key] = m.lru.PushFront(&cachedRemoteDocument{
+		key:   key,
+		entry: entry,
+		size:  size,
+	})
+	m.stats.Entries++
+	m.stats.Bytes += size
+
+	for (m.maxEntries > 0 && m.stats.Entries > m.maxEntries) ||
+		(m.maxBytes > 0 && m.stats.Bytes > m.maxBytes) {
+
+		m.remove(m.lru.Back())
+		m.stats.Evictions++
 	}
 
 	return nil
 }
 
+func (m *memoryCacheEngine) Delete(key string) error {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if el, ok := m.cache[key]; ok {
+		m.remove(el)
+	}
+	return nil
+}
+
+func (m *memoryCacheEngine) Purge() error {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	for el := m.lru.Front(); el != nil; el = m.lru.Front() {
+		m.remove(el)
+	}
+	return nil
+}
+
+// Keys returns keys of cached documents from the most recently used
+func (m *memoryCacheEngine) Keys() ([]string, error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	keys := make([]string, 0, m.lru.Len())
+	for el := m.lru.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Value.(*cachedRemoteDocument).key)
+	}
+	return keys, nil
+}
+
+// Range iterates cached documents from the most recently used. Documents
+// added during the iteration may be skipped. Unlike GetEntry, it does not
+// change the order of documents and statistics.
+func (m *memoryCacheEngine) Range(
+	fn func(key string, entry CacheEntry) bool) error {
+
+	// fn is called without the lock, so it may modify the cache
+	m.m.Lock()
+	docs := make([]*cachedRemoteDocument, 0, m.lru.Len())
+	for el := m.lru.Front(); el != nil; el = el.Next() {
+		docs = append(docs, el.Value.(*cachedRemoteDocument))
+	}
+	m.m.Unlock()
+
+	for _, cd := range docs {
+		if !fn(cd.key, cd.entry) {
+			break
+		}
+	}
+	return nil
+}
+
+// Stats returns the cache counters
+func (m *memoryCacheEngine) Stats() CacheStats {
+	m.m.Lock()
+	defer m.m.Unlock()
+	return m.stats
+}
+
+// maybePurge removes expired documents that may not be served stale anymore
+// if the purge interval has passed since the last purge. If the cache is
+// bounded by WithMaxCacheEntries or WithMaxCacheBytes, documents with
+// validators are kept, as they may be revalidated without downloading, and
+// are only evicted to fit into the limits. Must be called with the lock
+// held.
+func (m *memoryCacheEngine) maybePurge(now time.Time) {
+	if m.purgeInterval <= 0 || now.Sub(m.lastPurge) < m.purgeInterval {
+		return
+	}
+	m.lastPurge = now
+
+	bounded := m.maxEntries > 0 || m.maxBytes > 0
+	var next *list.Element
+	for el := m.lru.Front(); el != nil; el = next {
+		next = el.Next()
+		entry := el.Value.(*cachedRemoteDocument).entry
+		if !entry.ExpireTime.Before(now) || !entry.StaleUntil.Before(now) {
+			continue
+		}
+		if bounded && (entry.ETag != "" || entry.LastModified != "") {
+			continue
+		}
+		m.remove(el)
+		m.stats.Expirations++
+	}
+}
+
+// documentSize returns the approximate size of the cached document
+func documentSize(key string, doc *ld.RemoteDocument) (int64, error) {
+	size := int64(len(key))
+	if doc == nil {
+		return size, nil
+	}
+	docBytes, err := json.Marshal(doc.Document)
+	if err != nil {
+		return 0, err
+	}
+	return size + int64(len(docBytes)), nil
+}
+
+// remove deletes the list element from the cache. Must be called with the
+// lock held.
+func (m *memoryCacheEngine) remove(el *list.Element) {
+	cd := m.lru.Remove(el).(*cachedRemoteDocument)
+	delete(m.cache, cd.key)
+	m.stats.Entries--
+	m.stats.Bytes -= cd.size
+}
+
 type MemoryCacheEngineOption func(*memoryCacheEngine) error
 
 func WithEmbeddedDocumentBytes(u string, doc []byte) MemoryCacheEngineOption {
@@ -81,11 +292,61 @@ func WithEmbeddedDocumentBytes(u string, doc []byte) MemoryCacheEngineOption {
 	}
 }
 
+// WithMaxCacheEntries limits the number of cached documents. The least
+// recently used documents are evicted when the limit is reached. Zero means
+// no limit. Embedded documents do not count against the limit.
+func WithMaxCacheEntries(n int) MemoryCacheEngineOption {
+	return func(engine *memoryCacheEngine) error {
+		if n < 0 {
+			return errors.New("max cache entries must not be negative")
+		}
+		engine.maxEntries = n
+		return nil
+	}
+}
+
+// WithMaxCacheBytes limits the total size of cached documents encoded as
+// JSON. The least recently used documents are evicted when the limit is
+// reached. Zero means no limit. Embedded documents do not count against the
+// limit.
+func WithMaxCacheBytes(n int64) MemoryCacheEngineOption {
+	return func(engine *memoryCacheEngine) error {
+		if n < 0 {
+			return errors.New("max cache bytes must not be negative")
+		}
+		engine.maxBytes = n
+		return nil
+	}
+}
+
+// WithCachePurgeInterval sets how often expired documents are removed from
+// the cache. Documents with ETag or Last-Modified validators are kept if the
+// cache is bounded by WithMaxCacheEntries or WithMaxCacheBytes. Purging runs
+// on cache access, no background goroutine is started, so expired documents
+// of an idle cache stay in memory until the next GetEntry or SetEntry call.
+// Zero disables purging. Default is one minute.
+func WithCachePurgeInterval(d time.Duration) MemoryCacheEngineOption {
+	return func(engine *memoryCacheEngine) error {
+		if d < 0 {
+			return errors.New("cache purge interval must not be negative")
+		}
+		engine.purgeInterval = d
+		return nil
+	}
+}
+
+// NewMemoryCacheEngine creates the in-memory CacheEngine. Expired documents
+// are purged lazily on cache access (see WithCachePurgeInterval), and the
+// least recently used documents are evicted when the limits set by
+// WithMaxCacheEntries or WithMaxCacheBytes are exceeded.
 func NewMemoryCacheEngine(
 	opts ...MemoryCacheEngineOption) (CacheEngine, error) {
 
 	e := &memoryCacheEngine{
-		cache: make(map[string]*cachedRemoteDocument),
+		cache:         make(map[string]*list.Element),
+		lru:           list.New(),
+		purgeInterval: defaultCachePurgeInterval,
+		now:           time.Now,
 	}
 
 	for _, opt := range opts {
@@ -95,5 +356,6 @@ func NewMemoryCacheEngine(
 		}
 	}
 
+	e.lastPurge = e.now()
 	return e, nil
 }
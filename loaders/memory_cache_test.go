@@ -0,0 +1,239 @@
+package loaders
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/piprate/json-gold/ld"
+	"github.com/stretchr/testify/require"
+)
+
+func testRemoteDocument(u string) *ld.RemoteDocument {
+	return &ld.RemoteDocument{DocumentURL: u,
+		Document: map[string]any{"@context": map[string]any{}}}
+}
+
+func TestMemoryCacheEngine_MaxEntries(t *testing.T) {
+	cache, err := NewMemoryCacheEngine(WithMaxCacheEntries(2))
+	require.NoError(t, err)
+
+	expireTime := time.Now().Add(time.Hour)
+	require.NoError(t, cache.Set("a", testRemoteDocument("a"), expireTime))
+	require.NoError(t, cache.Set("b", testRemoteDocument("b"), expireTime))
+
+	// touch "a", so "b" is the least recently used
+	_, _, err = cache.Get("a")
+	require.NoError(t, err)
+
+	require.NoError(t, cache.Set("c", testRemoteDocument("c"), expireTime))
+
+	_, _, err = cache.Get("b")
+	require.ErrorIs(t, err, ErrCacheMiss)
+	_, _, err = cache.Get("a")
+	require.NoError(t, err)
+	_, _, err = cache.Get("c")
+	require.NoError(t, err)
+
+	stats := cache.(CacheStatsReporter).Stats()
+	require.Equal(t, uint64(3), stats.Hits)
+	require.Equal(t, uint64(1), stats.Misses)
+	require.Equal(t, uint64(1), stats.Evictions)
+	require.Equal(t, 2, stats.Entries)
+}
+
+func TestMemoryCacheEngine_MaxBytes(t *testing.T) {
+	// every test document is 1 byte key + 15 bytes of JSON
+	cache, err := NewMemoryCacheEngine(WithMaxCacheBytes(40))
+	require.NoError(t, err)
+
+	expireTime := time.Now().Add(time.Hour)
+	require.NoError(t, cache.Set("a", testRemoteDocument("a"), expireTime))
+	require.NoError(t, cache.Set("b", testRemoteDocument("b"), expireTime))
+	require.Equal(t, int64(32), cache.(CacheStatsReporter).Stats().Bytes)
+
+	require.NoError(t, cache.Set("c", testRemoteDocument("c"), expireTime))
+	_, _, err = cache.Get("a")
+	require.ErrorIs(t, err, ErrCacheMiss)
+
+	// too large document is not cached at all
+	big := &ld.RemoteDocument{DocumentURL: "d",
+		Document: strings.Repeat("x", 100)}
+	require.NoError(t, cache.Set("d", big, expireTime))
+	_, _, err = cache.Get("d")
+	require.ErrorIs(t, err, ErrCacheMiss)
+
+	stats := cache.(CacheStatsReporter).Stats()
+	require.Equal(t, 2, stats.Entries)
+	require.Equal(t, int64(32), stats.Bytes)
+	require.Equal(t, uint64(2), stats.Evictions)
+}
+
+func TestMemoryCacheEngine_NilDocument(t *testing.T) {
+	expireTime := time.Now().Add(time.Hour)
+	for _, opts := range [][]MemoryCacheEngineOption{
+		nil,
+		{WithMaxCacheBytes(40)},
+	} {
+		cache, err := NewMemoryCacheEngine(opts...)
+		require.NoError(t, err)
+
+		require.NoError(t, cache.Set("a", nil, expireTime))
+		doc, _, err := cache.Get("a")
+		require.NoError(t, err)
+		require.Nil(t, doc)
+	}
+}
+
+func TestMemoryCacheEngine_Purge(t *testing.T) {
+	cache, err := NewMemoryCacheEngine(
+		WithCachePurgeInterval(time.Minute))
+	require.NoError(t, err)
+
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	e := cache.(*memoryCacheEngine)
+	e.now = func() time.Time { return now }
+	e.lastPurge = now
+
+	require.NoError(t, cache.Set("a", testRemoteDocument("a"),
+		now.Add(10*time.Second)))
+	require.NoError(t, cache.Set("b", testRemoteDocument("b"),
+		now.Add(time.Hour)))
+
+	// expired, but the purge interval has not passed yet
+	now = now.Add(30 * time.Second)
+	_, _, err = cache.Get("a")
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	_, _, err = cache.Get("a")
+	require.ErrorIs(t, err, ErrCacheMiss)
+	_, _, err = cache.Get("b")
+	require.NoError(t, err)
+
+	stats := e.Stats()
+	require.Equal(t, uint64(1), stats.Expirations)
+	require.Equal(t, 1, stats.Entries)
+}
+
+func TestMemoryCacheEngine_PurgeValidators(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		opts []MemoryCacheEngineOption
+		kept bool
+	}{
+		{opts: nil},
+		{opts: []MemoryCacheEngineOption{WithMaxCacheEntries(10)},
+			kept: true},
+		{opts: []MemoryCacheEngineOption{WithMaxCacheBytes(1000)},
+			kept: true},
+	} {
+		cache, err := NewMemoryCacheEngine(tc.opts...)
+		require.NoError(t, err)
+		e := cache.(*memoryCacheEngine)
+		e.now = func() time.Time { return now }
+
+		require.NoError(t, e.SetEntry("a", CacheEntry{
+			Document:   testRemoteDocument("a"),
+			ExpireTime: now.Add(-time.Hour),
+			StaleUntil: now.Add(-time.Hour),
+			ETag:       `"v1"`,
+		}))
+		require.NoError(t, e.SetEntry("b", CacheEntry{
+			Document:     testRemoteDocument("b"),
+			ExpireTime:   now.Add(-time.Hour),
+			StaleUntil:   now.Add(-time.Hour),
+			LastModified: "Mon, 01 Jan 2029 00:00:00 GMT",
+		}))
+		e.lastPurge = now.Add(-time.Hour)
+
+		_, err = e.GetEntry("a")
+		if tc.kept {
+			require.NoError(t, err)
+			require.Equal(t, 2, e.Stats().Entries)
+		} else {
+			require.ErrorIs(t, err, ErrCacheMiss)
+			require.Equal(t, uint64(2), e.Stats().Expirations)
+		}
+	}
+}
+
+func TestMemoryCacheEngine_EmbeddedDocuments(t *testing.T) {
+	cache, err := NewMemoryCacheEngine(WithMaxCacheEntries(1),
+		WithEmbeddedDocumentBytes("a", []byte(`{"@context":{}}`)))
+	require.NoError(t, err)
+
+	expireTime := time.Now().Add(time.Hour)
+	require.NoError(t, cache.Set("a", testRemoteDocument("x"), expireTime))
+	require.NoError(t, cache.Set("b", testRemoteDocument("b"), expireTime))
+
+	doc, _, err := cache.Get("a")
+	require.NoError(t, err)
+	require.Equal(t, "a", doc.DocumentURL)
+	_, _, err = cache.Get("b")
+	require.NoError(t, err)
+
+	stats := cache.(CacheStatsReporter).Stats()
+	require.Equal(t, 1, stats.Entries)
+	require.Equal(t, uint64(0), stats.Evictions)
+}
+
+func TestNewMemoryCacheEngine_InvalidOptions(t *testing.T) {
+	_, err := NewMemoryCacheEngine(WithMaxCacheEntries(-1))
+	require.EqualError(t, err, "max cache entries must not be negative")
+	_, err = NewMemoryCacheEngine(WithMaxCacheBytes(-1))
+	require.EqualError(t, err, "max cache bytes must not be negative")
+	_, err = NewMemoryCacheEngine(WithCachePurgeInterval(-1))
+	require.EqualError(t, err, "cache purge interval must not be negative")
+}
+
+func TestMemoryCacheEngine_Management(t *testing.T) {
+	cache, err := NewMemoryCacheEngine(
+		WithEmbeddedDocumentBytes("https://example.com/embedded",
+			[]byte(`{"@context":{}}`)))
+	require.NoError(t, err)
+	mc := cache.(ManagedCacheEngine)
+
+	expireTime := time.Now().Add(time.Hour)
+	for _, u := range []string{"a", "b", "c"} {
+		require.NoError(t, cache.Set(u, testRemoteDocument(u), expireTime))
+	}
+	_, _, err = cache.Get("a")
+	require.NoError(t, err)
+
+	keys, err := mc.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "c", "b"}, keys)
+
+	// Range stops when fn returns false and fn may delete documents
+	var ranged []string
+	err = mc.Range(func(key string, entry CacheEntry) bool {
+		require.Equal(t, key, entry.Document.DocumentURL)
+		require.True(t, expireTime.Equal(entry.ExpireTime))
+		ranged = append(ranged, key)
+		require.NoError(t, mc.Delete(key))
+		return len(ranged) < 2
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "c"}, ranged)
+	keys, err = mc.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, keys)
+
+	// Range does not count hits
+	require.Equal(t, uint64(1), cache.(CacheStatsReporter).Stats().Hits)
+
+	require.NoError(t, mc.Delete("missing"))
+	require.NoError(t, cache.Set("d", testRemoteDocument("d"), expireTime))
+	require.NoError(t, mc.Purge())
+	keys, err = mc.Keys()
+	require.NoError(t, err)
+	require.Empty(t, keys)
+	stats := cache.(CacheStatsReporter).Stats()
+	require.Equal(t, 0, stats.Entries)
+	require.Equal(t, int64(0), stats.Bytes)
+
+	// embedded documents are kept
+	_, _, err = cache.Get("https://example.com/embedded")
+	require.NoError(t, err)
+}
@@ -0,0 +1,269 @@
+package loaders
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FetchSource is where the loader fetches documents from
+type FetchSource string
+
+const (
+	FetchSourceHTTP        FetchSource = "http"
+	FetchSourceIPFSGateway FetchSource = "ipfs-gateway"
+	FetchSourceIPFSNode    FetchSource = "ipfs-node"
+)
+
+// FetchEvent describes a single request of the loader
+type FetchEvent struct {
+	Source FetchSource
+	// URL is the requested URL, e.g. the URL of the IPFS gateway for
+	// documents loaded from it, or the path of the document for the IPFS node
+	URL string
+	// StatusCode is the HTTP status code, zero if there is no HTTP response
+	StatusCode int
+	// Bytes is the number of bytes of the response body read by the loader
+	Bytes int64
+	// Duration is the time of the request, including reading and parsing of
+	// the response
+	Duration time.Duration
+	Err      error
+}
+
+// LoaderObserver receives events of the document loader. Methods are called
+// synchronously from loading goroutines, so they must be fast and safe for
+// concurrent use.
+type LoaderObserver interface {
+	// CacheHit is called if the document is served from the cache,
+	// including stale documents
+	CacheHit(u string)
+	// CacheMiss is called if the document is not cached or has expired
+	CacheMiss(u string)
+	// FetchStarted is called before the request with Source and URL set
+	FetchStarted(e FetchEvent)
+	// FetchFinished is called after the request
+	FetchFinished(e FetchEvent)
+	// LoadFailed is called if LoadDocument returns the error
+	LoadFailed(u string, err error)
+}
+
+// WithObserver sets the observer of document loading, e.g. to tell whether
+// a slow load was caused by a cache miss, an IPFS fetch or a slow HTTP host
+func WithObserver(observer LoaderObserver) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.observer = observer
+	}
+}
+
+func (d *documentLoader) observeCache(u string, hit bool) {
+	switch {
+	case d.observer == nil:
+	case hit:
+		d.observer.CacheHit(u)
+	default:
+		d.observer.CacheMiss(u)
+	}
+}
+
+func (d *documentLoader) observeLoadError(u string, err error) {
+	if d.observer != nil && err != nil {
+		d.observer.LoadFailed(u, err)
+	}
+}
+
+// fetchObservation reports a single request to the observer. It is nil if
+// the loader has no observer.
+type fetchObservation struct {
+	observer LoaderObserver
+	event    FetchEvent
+	start    time.Time
+}
+
+func (d *documentLoader) startFetch(source FetchSource,
+	u string) *fetchObservation {
+
+	if d.observer == nil {
+		return nil
+	}
+	o := &fetchObservation{
+		observer: d.observer,
+		event:    FetchEvent{Source: source, URL: u},
+		start:    time.Now(),
+	}
+	o.observer.FetchStarted(o.event)
+	return o
+}
+
+func (o *fetchObservation) finish(statusCode int, n int64, err error) {
+	if o == nil {
+		return
+	}
+	o.event.StatusCode = statusCode
+	o.event.Bytes = n
+	o.event.Duration = time.Since(o.start)
+	o.event.Err = err
+	o.observer.FetchFinished(o.event)
+}
+
+// countingReader counts bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+var (
+	// DefaultDurationBuckets are bounds of FetchMetrics.Durations in seconds
+	DefaultDurationBuckets = []float64{
+		.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets are bounds of FetchMetrics.Sizes in bytes
+	DefaultSizeBuckets = []float64{
+		1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20}
+)
+
+// Histogram counts observed values in buckets
+type Histogram struct {
+	// Bounds are inclusive upper bounds of buckets in increasing order
+	Bounds []float64
+	// Counts are numbers of values in buckets. The last count is for values
+	// greater than all bounds.
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+func newHistogram(bounds []float64) Histogram {
+	return Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *Histogram) observe(v float64) {
+	h.Counts[sort.SearchFloat64s(h.Bounds, v)]++
+	h.Count++
+	h.Sum += v
+}
+
+func (h Histogram) clone() Histogram {
+	h.Bounds = append([]float64(nil), h.Bounds...)
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+// FetchMetrics are metrics of finished requests to a single source
+type FetchMetrics struct {
+	Requests uint64
+	Errors   uint64
+	// StatusCodes counts HTTP responses by status codes
+	StatusCodes map[int]uint64
+	Bytes       int64
+	// Durations is the histogram of request durations in seconds
+	Durations Histogram
+	// Sizes is the histogram of response sizes in bytes
+	Sizes Histogram
+}
+
+// LoaderMetrics are metrics collected by MetricsObserver
+type LoaderMetrics struct {
+	CacheHits   uint64
+	CacheMisses uint64
+	LoadErrors  uint64
+	// InFlight is the number of started requests that are not finished yet
+	InFlight int
+	Fetches  map[FetchSource]FetchMetrics
+}
+
+// MetricsObserver is the LoaderObserver that collects counters and
+// histograms in memory, e.g. for tests
+type MetricsObserver struct {
+	m               sync.Mutex
+	metrics         LoaderMetrics
+	durationBuckets []float64
+	sizeBuckets     []float64
+}
+
+// NewMetricsObserver creates MetricsObserver with DefaultDurationBuckets and
+// DefaultSizeBuckets
+func NewMetricsObserver() *MetricsObserver {
+	return &MetricsObserver{
+		metrics:         LoaderMetrics{Fetches: map[FetchSource]FetchMetrics{}},
+		durationBuckets: DefaultDurationBuckets,
+		sizeBuckets:     DefaultSizeBuckets,
+	}
+}
+
+func (o *MetricsObserver) CacheHit(string) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.metrics.CacheHits++
+}
+
+func (o *MetricsObserver) CacheMiss(string) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.metrics.CacheMisses++
+}
+
+func (o *MetricsObserver) FetchStarted(FetchEvent) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.metrics.InFlight++
+}
+
+func (o *MetricsObserver) FetchFinished(e FetchEvent) {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	o.metrics.InFlight--
+	fm, ok := o.metrics.Fetches[e.Source]
+	if !ok {
+		fm = FetchMetrics{
+			StatusCodes: map[int]uint64{},
+			Durations:   newHistogram(o.durationBuckets),
+			Sizes:       newHistogram(o.sizeBuckets),
+		}
+	}
+	fm.Requests++
+	if e.Err != nil {
+		fm.Errors++
+	}
+	if e.StatusCode != 0 {
+		fm.StatusCodes[e.StatusCode]++
+	}
+	fm.Bytes += e.Bytes
+	fm.Durations.observe(e.Duration.Seconds())
+	fm.Sizes.observe(float64(e.Bytes))
+	o.metrics.Fetches[e.Source] = fm
+}
+
+func (o *MetricsObserver) LoadFailed(string, error) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.metrics.LoadErrors++
+}
+
+// Metrics returns the copy of collected metrics
+func (o *MetricsObserver) Metrics() LoaderMetrics {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	metrics := o.metrics
+	metrics.Fetches = make(map[FetchSource]FetchMetrics,
+		len(o.metrics.Fetches))
+	for source, fm := range o.metrics.Fetches {
+		statusCodes := make(map[int]uint64, len(fm.StatusCodes))
+		for code, n := range fm.StatusCodes {
+			statusCodes[code] = n
+		}
+		fm.StatusCodes = statusCodes
+		fm.Durations = fm.Durations.clone()
+		fm.Sizes = fm.Sizes.clone()
+		metrics.Fetches[source] = fm
+	}
+	return metrics
+}
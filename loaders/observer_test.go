@@ -0,0 +1,181 @@
+package loaders
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingObserver records events as strings
+type recordingObserver struct {
+	m      sync.Mutex
+	events []string
+	*MetricsObserver
+}
+
+func newRecordingObserver() *recordingObserver {
+	return &recordingObserver{MetricsObserver: NewMetricsObserver()}
+}
+
+func (o *recordingObserver) record(event string) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.events = append(o.events, event)
+}
+
+func (o *recordingObserver) CacheHit(u string) {
+	o.record("hit " + u)
+	o.MetricsObserver.CacheHit(u)
+}
+
+func (o *recordingObserver) CacheMiss(u string) {
+	o.record("miss " + u)
+	o.MetricsObserver.CacheMiss(u)
+}
+
+func (o *recordingObserver) FetchStarted(e FetchEvent) {
+	o.record("start " + string(e.Source) + " " + e.URL)
+	o.MetricsObserver.FetchStarted(e)
+}
+
+func (o *recordingObserver) FetchFinished(e FetchEvent) {
+	o.record("finish " + string(e.Source) + " " + e.URL)
+	o.MetricsObserver.FetchFinished(e)
+}
+
+func (o *recordingObserver) LoadFailed(u string, err error) {
+	o.record("fail " + u)
+	o.MetricsObserver.LoadFailed(u, err)
+}
+
+func TestDocumentLoader_ObserverHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/context.jsonld" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Cache-Control", "max-age=3600")
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+	u := srv.URL + "/context.jsonld"
+	missing := srv.URL + "/missing.jsonld"
+
+	observer := newRecordingObserver()
+	loader := NewDocumentLoader(nil, "", WithObserver(observer))
+	for i := 0; i < 2; i++ {
+		_, err := loader.LoadDocument(u)
+		require.NoError(t, err)
+	}
+	_, err := loader.LoadDocument(missing)
+	require.Error(t, err)
+
+	require.Equal(t, []string{
+		"miss " + u,
+		"start http " + u,
+		"finish http " + u,
+		"hit " + u,
+		"miss " + missing,
+		"start http " + missing,
+		"finish http " + missing,
+		"fail " + missing,
+	}, observer.events)
+
+	metrics := observer.Metrics()
+	require.Equal(t, uint64(1), metrics.CacheHits)
+	require.Equal(t, uint64(2), metrics.CacheMisses)
+	require.Equal(t, uint64(1), metrics.LoadErrors)
+	require.Equal(t, 0, metrics.InFlight)
+
+	fm := metrics.Fetches[FetchSourceHTTP]
+	require.Equal(t, uint64(2), fm.Requests)
+	require.Equal(t, uint64(1), fm.Errors)
+	require.Equal(t, map[int]uint64{200: 1, 404: 1}, fm.StatusCodes)
+	require.Equal(t, int64(len(testIPFSDoc)), fm.Bytes)
+	require.Equal(t, uint64(2), fm.Durations.Count)
+	require.Equal(t, uint64(2), fm.Sizes.Count)
+	require.Equal(t, uint64(2), fm.Sizes.Counts[0])
+}
+
+func TestDocumentLoader_ObserverIPFS(t *testing.T) {
+	ipfsPath := strings.TrimPrefix(testIPFSURL, ipfsPrefix)
+	ipfsCli := &mockIPFSClient{docs: map[string]string{
+		ipfsPath: testIPFSDoc}}
+
+	observer := newRecordingObserver()
+	loader := NewDocumentLoader(ipfsCli, "", WithObserver(observer))
+	_, err := loader.LoadDocument(testIPFSURL)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"miss " + testIPFSURL,
+		"start ipfs-node " + ipfsPath,
+		"finish ipfs-node " + ipfsPath,
+	}, observer.events)
+	fm := observer.Metrics().Fetches[FetchSourceIPFSNode]
+	require.Equal(t, uint64(1), fm.Requests)
+	require.Equal(t, int64(len(testIPFSDoc)), fm.Bytes)
+	require.Empty(t, fm.StatusCodes)
+
+	gw := newIPFSGateway(t, false)
+	observer = newRecordingObserver()
+	loader = NewDocumentLoader(nil, gw.URL, WithObserver(observer),
+		WithIPFSGatewayVerification())
+	_, err = loader.LoadDocument("ipfs://" + testRawCID)
+	require.NoError(t, err)
+	blockURL := gw.URL + "/ipfs/" + testRawCID + "?format=raw"
+	require.Equal(t, []string{
+		"miss ipfs://" + testRawCID,
+		"start ipfs-gateway " + blockURL,
+		"finish ipfs-gateway " + blockURL,
+	}, observer.events)
+	fm = observer.Metrics().Fetches[FetchSourceIPFSGateway]
+	require.Equal(t, map[int]uint64{200: 1}, fm.StatusCodes)
+	require.Positive(t, fm.Bytes)
+}
+
+func TestDocumentLoader_ObserverIPFSBlockTooLarge(t *testing.T) {
+	gw := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w,
+				strings.Repeat("x", maxIPFSBlockSize+10))
+		}))
+	defer gw.Close()
+
+	observer := newRecordingObserver()
+	loader := NewDocumentLoader(nil, gw.URL, WithCacheEngine(nil),
+		WithObserver(observer), WithIPFSGatewayVerification())
+	_, err := loader.LoadDocument("ipfs://" + testRawCID)
+	require.ErrorIs(t, err, ErrDocumentTooLarge)
+
+	// bytes read before the limit was hit are reported
+	fm := observer.Metrics().Fetches[FetchSourceIPFSGateway]
+	require.Equal(t, uint64(1), fm.Errors)
+	require.Equal(t, int64(maxIPFSBlockSize+1), fm.Bytes)
+}
+
+func TestMetricsObserver_Metrics(t *testing.T) {
+	observer := NewMetricsObserver()
+	observer.FetchStarted(FetchEvent{Source: FetchSourceHTTP})
+	observer.FetchFinished(FetchEvent{Source: FetchSourceHTTP,
+		StatusCode: 200, Bytes: 4 << 10})
+
+	metrics := observer.Metrics()
+	fm := metrics.Fetches[FetchSourceHTTP]
+	// bounds are inclusive
+	require.Equal(t, []uint64{0, 1, 0, 0, 0, 0, 0, 0}, fm.Sizes.Counts)
+	require.Equal(t, float64(4<<10), fm.Sizes.Sum)
+
+	// the returned metrics are not changed by next events
+	observer.FetchFinished(FetchEvent{Source: FetchSourceHTTP,
+		StatusCode: 200, Bytes: 8 << 20})
+	require.Equal(t, map[int]uint64{200: 1}, fm.StatusCodes)
+	require.Equal(t, []uint64{0, 1, 0, 0, 0, 0, 0, 0}, fm.Sizes.Counts)
+	require.Equal(t, []uint64{0, 1, 0, 0, 0, 0, 0, 1},
+		observer.Metrics().Fetches[FetchSourceHTTP].Sizes.Counts)
+}
@@ -0,0 +1,90 @@
+package loaders
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/piprate/json-gold/ld"
+)
+
+// errFlightPanicked is returned to callers waiting for the call that
+// panicked
+var errFlightPanicked = errors.New("document loading panicked")
+
+// flightCall is a document loading in progress
+type flightCall struct {
+	done chan struct{}
+	doc  *ld.RemoteDocument
+	err  error
+	// canceled is true if the call failed because the context of the caller
+	// that started it was canceled
+	canceled bool
+	// dups is the number of callers waiting for the result
+	dups int
+}
+
+// flightGroup coalesces concurrent loadings of the same URL, so only one
+// request per URL is in flight and all callers share its result
+type flightGroup struct {
+	m     sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do calls fn if there is no call in flight for the key, otherwise waits for
+// the result of the call in flight. If the call in flight fails because its
+// caller is canceled, the waiters with alive contexts retry.
+func (g *flightGroup) do(ctx context.Context, key string,
+	fn func() (*ld.RemoteDocument, error)) (*ld.RemoteDocument, error) {
+
+	for {
+		g.m.Lock()
+		if g.calls == nil {
+			g.calls = make(map[string]*flightCall)
+		}
+
+		c, ok := g.calls[key]
+		if !ok {
+			break
+		}
+		c.dups++
+		g.m.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed, ctx.Err())
+		case <-c.done:
+		}
+
+		if c.canceled && ctx.Err() == nil {
+			continue
+		}
+		return c.doc, c.err
+	}
+
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.m.Unlock()
+
+	// the call is finished even if fn panics, so waiters do not block
+	// forever
+	returned := false
+	defer func() {
+		if !returned {
+			c.doc, c.err = nil, ld.NewJsonLdError(ld.LoadingDocumentFailed,
+				errFlightPanicked)
+		}
+		g.m.Lock()
+		delete(g.calls, key)
+		g.m.Unlock()
+		close(c.done)
+	}()
+
+	c.doc, c.err = fn()
+	c.canceled = c.err != nil && ctx.Err() != nil &&
+		(errors.Is(c.err, context.Canceled) ||
+			errors.Is(c.err, context.DeadlineExceeded))
+	returned = true
+
+	return c.doc, c.err
+}
@@ -0,0 +1,250 @@
+package loaders
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/piprate/json-gold/ld"
+	"github.com/stretchr/testify/require"
+)
+
+const testConcurrentLoads = 20
+
+// waitFlightWaiters blocks until n callers wait for the call in flight
+func waitFlightWaiters(t testing.TB, g *flightGroup, key string, n int) {
+	require.Eventually(t, func() bool {
+		g.m.Lock()
+		defer g.m.Unlock()
+		c, ok := g.calls[key]
+		return ok && c.dups == n
+	}, 5*time.Second, time.Millisecond)
+}
+
+type loadResult struct {
+	doc *ld.RemoteDocument
+	err error
+}
+
+// loadConcurrently starts testConcurrentLoads loads of the URL, waits until
+// all of them are coalesced into one call, calls release and returns results
+func loadConcurrently(t testing.TB, loader DocumentLoader, u string,
+	release func()) []loadResult {
+
+	results := make([]loadResult, testConcurrentLoads)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i].doc, results[i].err = loader.LoadDocument(u)
+		}(i)
+	}
+
+	waitFlightWaiters(t, &loader.(*documentLoader).flights, u,
+		testConcurrentLoads-1)
+	release()
+	wg.Wait()
+	return results
+}
+
+func TestDocumentLoader_CoalesceHTTP(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			<-release
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	defer srv.Close()
+
+	// without cache every load would go to the server
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(nil))
+	u := srv.URL + "/context.jsonld"
+	results := loadConcurrently(t, loader, u, func() { close(release) })
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	for _, r := range results {
+		require.NoError(t, r.err)
+		require.Same(t, results[0].doc, r.doc)
+	}
+
+	// the next load makes a new request
+	_, err := loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestDocumentLoader_CoalesceHTTPError(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			<-release
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+	defer srv.Close()
+
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(nil))
+	results := loadConcurrently(t, loader, srv.URL+"/context.jsonld",
+		func() { close(release) })
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	for _, r := range results {
+		require.EqualError(t, r.err,
+			"loading document failed: Bad response status code: 500")
+	}
+}
+
+type countingBlockingIPFSClient struct {
+	calls   int32
+	release chan struct{}
+}
+
+func (c *countingBlockingIPFSClient) Cat(string) (io.ReadCloser, error) {
+	atomic.AddInt32(&c.calls, 1)
+	<-c.release
+	return io.NopCloser(strings.NewReader(testIPFSDoc)), nil
+}
+
+func TestDocumentLoader_CoalesceIPFS(t *testing.T) {
+	ipfsCli := &countingBlockingIPFSClient{release: make(chan struct{})}
+	loader := NewDocumentLoader(ipfsCli, "", WithCacheEngine(nil))
+	results := loadConcurrently(t, loader, testIPFSURL,
+		func() { close(ipfsCli.release) })
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&ipfsCli.calls))
+	for _, r := range results {
+		require.NoError(t, r.err)
+		require.Equal(t, testIPFSURL, r.doc.DocumentURL)
+	}
+}
+
+func TestFlightGroup_CanceledLeader(t *testing.T) {
+	var g flightGroup
+	const key = "https://example.com/context.jsonld"
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := g.do(leaderCtx, key, func() (*ld.RemoteDocument, error) {
+			close(started)
+			<-leaderCtx.Done()
+			return nil, ld.NewJsonLdError(ld.LoadingDocumentFailed,
+				leaderCtx.Err())
+		})
+		leaderErr <- err
+	}()
+	<-started
+
+	var calls int32
+	waiterDone := make(chan loadResult, 1)
+	go func() {
+		doc, err := g.do(context.Background(), key,
+			func() (*ld.RemoteDocument, error) {
+				atomic.AddInt32(&calls, 1)
+				return &ld.RemoteDocument{DocumentURL: key}, nil
+			})
+		waiterDone <- loadResult{doc, err}
+	}()
+	waitFlightWaiters(t, &g, key, 1)
+	cancelLeader()
+
+	require.ErrorIs(t, <-leaderErr, context.Canceled)
+
+	// the waiter is not canceled, so it loads the document itself
+	res := <-waiterDone
+	require.NoError(t, res.err)
+	require.Equal(t, key, res.doc.DocumentURL)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestFlightGroup_CanceledWaiter(t *testing.T) {
+	var g flightGroup
+	const key = "https://example.com/context.jsonld"
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	leaderDone := make(chan loadResult, 1)
+	go func() {
+		doc, err := g.do(context.Background(), key,
+			func() (*ld.RemoteDocument, error) {
+				close(started)
+				<-release
+				return &ld.RemoteDocument{DocumentURL: key}, nil
+			})
+		leaderDone <- loadResult{doc, err}
+	}()
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	waiterErr := make(chan error, 1)
+	go func() {
+		_, err := g.do(ctx, key, func() (*ld.RemoteDocument, error) {
+			return nil, errors.New("must not be called")
+		})
+		waiterErr <- err
+	}()
+	waitFlightWaiters(t, &g, key, 1)
+
+	// canceled waiter returns immediately, the call in flight goes on
+	cancel()
+	require.ErrorIs(t, <-waiterErr, context.Canceled)
+
+	close(release)
+	res := <-leaderDone
+	require.NoError(t, res.err)
+	require.Equal(t, key, res.doc.DocumentURL)
+}
+
+func TestFlightGroup_Panic(t *testing.T) {
+	var g flightGroup
+	const key = "https://example.com/context.jsonld"
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	leaderPanic := make(chan any, 1)
+	go func() {
+		defer func() { leaderPanic <- recover() }()
+		_, _ = g.do(context.Background(), key,
+			func() (*ld.RemoteDocument, error) {
+				close(started)
+				<-release
+				panic("test panic")
+			})
+	}()
+	<-started
+
+	waiterErr := make(chan error, 1)
+	go func() {
+		_, err := g.do(context.Background(), key,
+			func() (*ld.RemoteDocument, error) {
+				return nil, errors.New("must not be called")
+			})
+		waiterErr <- err
+	}()
+	waitFlightWaiters(t, &g, key, 1)
+
+	// the panic is propagated to the leader, waiters get the error
+	close(release)
+	require.Equal(t, "test panic", <-leaderPanic)
+	require.ErrorIs(t, <-waiterErr, errFlightPanicked)
+
+	// the next call is not blocked by the panicked one
+	doc, err := g.do(context.Background(), key,
+		func() (*ld.RemoteDocument, error) {
+			return &ld.RemoteDocument{DocumentURL: key}, nil
+		})
+	require.NoError(t, err)
+	require.Equal(t, key, doc.DocumentURL)
+}
@@ -0,0 +1,66 @@
+package loaders
+
+import (
+	"regexp"
+	"strings"
+)
+
+// WithURLRewrite makes the loader load documents with URLs starting with
+// prefix from URLs where the prefix is replaced, e.g. to load
+// https://schema.iden3.io/ documents from an internal mirror, or ipfs://
+// documents from a local gateway with "http://localhost:8080/ipfs/".
+// Documents keep their original URLs in RemoteDocument.DocumentURL and are
+// cached under them. Rewrite rules are tried in the order of options, and
+// the first matching one is applied.
+//
+// The rewritten URLs are trusted like the IPFS gateway: they are not
+// checked against scheme and host lists, and private networks are not
+// blocked for them. The original URLs are checked.
+func WithURLRewrite(prefix, replacement string) DocumentLoaderOption {
+	return func(loader *documentLoader) {
+		loader.rewriteRules = append(loader.rewriteRules,
+			urlRewriteRule{prefix: prefix, replacement: replacement})
+	}
+}
+
+// WithURLRewriteRegexp is like WithURLRewrite, but rewrites URLs matching
+// re. Matches are replaced with replacement as in
+// regexp.Regexp.ReplaceAllString, so it may refer to submatches, e.g. $1.
+func WithURLRewriteRegexp(re *regexp.Regexp,
+	replacement string) DocumentLoaderOption {
+
+	return func(loader *documentLoader) {
+		loader.rewriteRules = append(loader.rewriteRules,
+			urlRewriteRule{re: re, replacement: replacement})
+	}
+}
+
+type urlRewriteRule struct {
+	prefix      string
+	re          *regexp.Regexp
+	replacement string
+}
+
+func (r urlRewriteRule) rewrite(u string) (string, bool) {
+	if r.re != nil {
+		if !r.re.MatchString(u) {
+			return u, false
+		}
+		return r.re.ReplaceAllString(u, r.replacement), true
+	}
+
+	if !strings.HasPrefix(u, r.prefix) {
+		return u, false
+	}
+	return r.replacement + u[len(r.prefix):], true
+}
+
+// rewriteURL returns the URL to load the document from
+func (d *documentLoader) rewriteURL(u string) string {
+	for _, r := range d.rewriteRules {
+		if src, ok := r.rewrite(u); ok {
+			return src
+		}
+	}
+	return u
+}
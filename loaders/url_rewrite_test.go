@@ -0,0 +1,145 @@
+package loaders
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mirrorServer struct {
+	*httptest.Server
+	m     sync.Mutex
+	paths []string
+}
+
+// newMirrorServer serves the document with the cache header and records
+// requested paths
+func newMirrorServer(t testing.TB) *mirrorServer {
+	srv := &mirrorServer{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			srv.m.Lock()
+			srv.paths = append(srv.paths, r.URL.Path)
+			srv.m.Unlock()
+			w.Header().Set("Cache-Control", "max-age=3600")
+			_, _ = io.WriteString(w, testIPFSDoc)
+		}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (srv *mirrorServer) Paths() []string {
+	srv.m.Lock()
+	defer srv.m.Unlock()
+	return srv.paths
+}
+
+func TestDocumentLoader_URLRewrite(t *testing.T) {
+	srv := newMirrorServer(t)
+	const u = "https://schema.example.com/v1/context.jsonld"
+
+	loader := NewDocumentLoader(nil, "",
+		WithURLRewrite("https://schema.example.com/", srv.URL+"/mirror/"),
+		WithURLRewrite("https://schema.example.com/v1/", srv.URL+"/v1/"),
+		WithPrivateNetworksBlocked())
+	for i := 0; i < 2; i++ {
+		doc, err := loader.LoadDocument(u)
+		require.NoError(t, err)
+		require.Equal(t, u, doc.DocumentURL)
+	}
+	// the first rule is applied and the document is cached under the
+	// original URL
+	require.Equal(t, []string{"/mirror/v1/context.jsonld"}, srv.Paths())
+
+	// original URLs are still checked
+	loader = NewDocumentLoader(nil, "",
+		WithURLRewrite("https://schema.example.com/", srv.URL+"/mirror/"),
+		WithDeniedHosts("schema.example.com"))
+	_, err := loader.LoadDocument(u)
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+	require.Len(t, srv.Paths(), 1)
+}
+
+func TestDocumentLoader_URLRewriteLimits(t *testing.T) {
+	// the mirror redirects to itself
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, r.URL.Path, http.StatusFound)
+		}))
+	defer srv.Close()
+
+	// rewritten URLs are trusted, but redirects are still limited
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(nil),
+		WithURLRewrite("https://schema.example.com/", srv.URL+"/"),
+		WithPrivateNetworksBlocked(), WithMaxRedirects(2))
+	_, err := loader.LoadDocument(
+		"https://schema.example.com/context.jsonld")
+	require.ErrorIs(t, err, ErrTooManyRedirects)
+}
+
+func TestDocumentLoader_URLRewriteRegexp(t *testing.T) {
+	srv := newMirrorServer(t)
+
+	loader := NewDocumentLoader(nil, "", WithCacheEngine(nil),
+		WithURLRewriteRegexp(
+			regexp.MustCompile(`^https://([a-z]+)\.example\.com/`),
+			srv.URL+"/$1/"))
+	doc, err := loader.LoadDocument("https://partner.example.com/ctx.json")
+	require.NoError(t, err)
+	require.Equal(t, "https://partner.example.com/ctx.json", doc.DocumentURL)
+
+	_, err = loader.LoadDocument(srv.URL + "/other.json")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"/partner/ctx.json", "/other.json"},
+		srv.Paths())
+}
+
+func TestDocumentLoader_URLRewriteIPFS(t *testing.T) {
+	gw := newIPFSGateway(t, false)
+	u := "ipfs://" + testRawCID
+
+	// the local gateway replaces the IPFS client
+	loader := NewDocumentLoader(nil, "",
+		WithURLRewrite("ipfs://", gw.URL+"/ipfs/"))
+	doc, err := loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, u, doc.DocumentURL)
+	require.Equal(t, testIPFSDocument(t), doc.Document)
+
+	// and vice versa
+	loader = NewDocumentLoader(nil, gw.URL,
+		WithURLRewrite("https://schema.example.com/", "ipfs://"))
+	doc, err = loader.LoadDocument("https://schema.example.com/" + testRawCID)
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.example.com/"+testRawCID,
+		doc.DocumentURL)
+	require.Equal(t, testIPFSDocument(t), doc.Document)
+}
+
+func TestDocumentLoader_URLRewriteFile(t *testing.T) {
+	root := t.TempDir()
+	name := filepath.Join(root, "context.jsonld")
+	require.NoError(t, os.WriteFile(name, []byte(testLocalDoc), 0o600))
+	const u = "https://schema.example.com/context.jsonld"
+	rewrite := WithURLRewrite("https://schema.example.com/",
+		fileURL(root)+"/")
+
+	loader := NewDocumentLoader(nil, "", rewrite, WithFileURLs(root),
+		WithOfflineMode())
+	doc, err := loader.LoadDocument(u)
+	require.NoError(t, err)
+	require.Equal(t, u, doc.DocumentURL)
+
+	loader = NewDocumentLoader(nil, "", rewrite)
+	_, err = loader.LoadDocument(u)
+	require.EqualError(t, err,
+		"loading document failed: unsupported URL schema")
+}
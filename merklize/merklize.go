@@ -22,9 +22,9 @@ import (
 )
 
 var (
-	defaultHasher         Hasher = PoseidonHasher{}
-	defaultDocumentLoader        = loaders.NewDocumentLoader(nil, "")
-	numRE                        = regexp.MustCompile(`^\d+$`)
+	defaultHasher         Hasher            = PoseidonHasher{}
+	defaultDocumentLoader ld.DocumentLoader = loaders.NewDocumentLoader(nil, "")
+	numRE                                   = regexp.MustCompile(`^\d+$`)
 )
 
 var (
@@ -72,6 +72,13 @@ func (o Options) getDocumentLoader() ld.DocumentLoader {
 	return defaultDocumentLoader
 }
 
+// WithContext returns a copy of options with the document loader bound to
+// ctx, so loading of documents stops when ctx is canceled
+func (o Options) WithContext(ctx context.Context) Options {
+	o.DocumentLoader = loaders.BindContext(ctx, o.getDocumentLoader())
+	return o
+}
+
 func (o Options) JSONLDOptions() *ld.JsonLdOptions {
 	return newJSONLDOptions(true, o.getDocumentLoader())
 }
@@ -1561,7 +1568,8 @@ func MerklizeJSONLD(ctx context.Context, in io.Reader,
 	}
 
 	proc := ld.NewJsonLdProcessor()
-	options := newJSONLDOptions(mz.safeMode, mz.getDocumentLoader())
+	options := newJSONLDOptions(mz.safeMode,
+		loaders.BindContext(ctx, mz.getDocumentLoader()))
 	normDoc, err := proc.Normalize(obj, options)
 	if err != nil {
 		return nil, err
@@ -1609,6 +1617,27 @@ func (mz *Merklizer) Entry(path Path) (RDFEntry, error) {
 	return e, nil
 }
 
+// Entries returns all entries of the merklized document ordered by key
+func (mz *Merklizer) Entries() []RDFEntry {
+	keys := make([]string, 0, len(mz.entries))
+	for k := range mz.entries {
+		keys = append(keys, k)
+	}
+	// keys are decimal representations of non-negative integers
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) < len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	entries := make([]RDFEntry, len(keys))
+	for i, k := range keys {
+		entries[i] = mz.entries[k]
+	}
+	return entries
+}
+
 func (mz *Merklizer) getDocumentLoader() ld.DocumentLoader {
 	if mz.documentLoader != nil {
 		return mz.documentLoader
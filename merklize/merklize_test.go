@@ -2097,3 +2097,58 @@ func mergeMaps(ms ...map[string]string) map[string]string {
 
 	return res
 }
+
+func TestMerklizer_Entries(t *testing.T) {
+	defer tst.MockHTTPClient(t, testDocumentURLMaps,
+		tst.IgnoreUntouchedURLs())()
+
+	ctx := context.Background()
+	mz, err := MerklizeJSONLD(ctx, strings.NewReader(testDocument))
+	require.NoError(t, err)
+
+	entries := mz.Entries()
+	require.NotEmpty(t, entries)
+
+	mt, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), 40)
+	require.NoError(t, err)
+	err = AddEntriesToMerkleTree(ctx, mt, entries)
+	require.NoError(t, err)
+	require.Equal(t, mz.Root(), mt.Root())
+
+	var prevKey *big.Int
+	for _, e := range entries {
+		key, err := e.KeyMtEntry()
+		require.NoError(t, err)
+		if prevKey != nil {
+			require.Equal(t, 1, key.Cmp(prevKey))
+		}
+		prevKey = key
+
+		fromMz, err := mz.Entry(e.Key())
+		require.NoError(t, err)
+		require.Equal(t, e, fromMz)
+	}
+
+	birthDatePath, err := NewPath(
+		"https://www.w3.org/2018/credentials#credentialSubject", 1,
+		"http://schema.org/birthDate")
+	require.NoError(t, err)
+	e, err := mz.Entry(birthDatePath)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(1958, 7, 18, 0, 0, 0, 0, time.UTC), e.Value())
+	require.Equal(t, ld.XSDNS+"dateTime", e.Datatype())
+}
+
+func TestMerklizeJSONLD_CanceledContext(t *testing.T) {
+	defer tst.MockHTTPClient(t, testDocumentURLMaps,
+		tst.IgnoreUntouchedURLs())()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// no HTTP requests are made, so untouched mocked URLs are expected
+	_, err := MerklizeJSONLD(ctx, strings.NewReader(testDocument),
+		WithDocumentLoader(loaders.NewDocumentLoader(nil, "",
+			loaders.WithCacheEngine(nil))))
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -28,6 +28,23 @@ func NewRDFEntry(key Path, value any) (RDFEntry, error) {
 	return Options{}.NewRDFEntry(key, value)
 }
 
+// Key returns the path of the entry
+func (e RDFEntry) Key() Path {
+	return e.key
+}
+
+// Value returns the value of the entry: int64, string, bool, time.Time or
+// *big.Int
+func (e RDFEntry) Value() any {
+	return e.value
+}
+
+// Datatype returns the expanded XSD datatype of the value, empty if the
+// value has no datatype
+func (e RDFEntry) Datatype() string {
+	return e.datatype
+}
+
 func (e RDFEntry) KeyMtEntry() (*big.Int, error) {
 	return e.key.MtEntry()
 }
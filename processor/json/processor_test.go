@@ -2,12 +2,15 @@ package json
 
 import (
 	"context"
+	stdjson "encoding/json"
+	"os"
 	"testing"
 
 	"github.com/iden3/go-schema-processor/v2/json"
 	"github.com/iden3/go-schema-processor/v2/loaders"
 	"github.com/iden3/go-schema-processor/v2/processor"
 	tst "github.com/iden3/go-schema-processor/v2/testing"
+	"github.com/iden3/go-schema-processor/v2/verifiable"
 	"github.com/stretchr/testify/require"
 )
 
@@ -78,4 +81,147 @@ func TestValidatorWithInvalidField(t *testing.T) {
 
 	err = jsonProcessor.ValidateData(dataBytes, schema)
 	require.ErrorContains(t, err, "missing properties: 'birthday'")
+
+	var validationErr *processor.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, []processor.Violation{{
+		InstanceLocation: "",
+		Keyword:          "required",
+		KeywordLocation:  "/required",
+		SchemaLocation:   "#/required",
+		Message:          "missing properties: 'birthday'",
+	}}, validationErr.Violations)
+}
+
+func TestValidateCredential(t *testing.T) {
+	ipfsCli := tst.MockIPFSClient{
+		"QmQVeb5dkz5ekDqBrYVVxBFQZoCbzamnmMUn9B8twCEgDL": "testdata/schema-test-new-type.json",
+	}
+	loader := loaders.NewDocumentLoader(ipfsCli, "")
+	jsonProcessor := New(processor.WithValidator(json.NewValidator()),
+		processor.WithDocumentLoader(loader))
+
+	credBytes, err := os.ReadFile("testdata/credential-test-new-type.json")
+	require.NoError(t, err)
+
+	readCredential := func(t testing.TB) verifiable.W3CCredential {
+		var cred verifiable.W3CCredential
+		err = stdjson.Unmarshal(credBytes, &cred)
+		require.NoError(t, err)
+		return cred
+	}
+
+	ctx := context.Background()
+
+	t.Run("valid credential", func(t *testing.T) {
+		cred := readCredential(t)
+		res, err := jsonProcessor.ValidateCredential(ctx, cred)
+		require.NoError(t, err)
+		require.Equal(t, &processor.ValidationResult{
+			Valid:      true,
+			SchemaID:   cred.CredentialSchema.ID,
+			SchemaType: verifiable.JSONSchema2023,
+		}, res)
+
+		cred.CredentialSchema.Type = verifiable.JSONSchemaValidator2018
+		res, err = jsonProcessor.ValidateCredential(ctx, cred)
+		require.NoError(t, err)
+		require.True(t, res.Valid)
+	})
+
+	t.Run("invalid credential", func(t *testing.T) {
+		cred := readCredential(t)
+		cred.CredentialSubject["testNewTypeInt"] = "1"
+		res, err := jsonProcessor.ValidateCredential(ctx, cred)
+		require.NoError(t, err)
+		require.False(t, res.Valid)
+		require.Len(t, res.Violations, 1)
+		require.Equal(t, "/credentialSubject/testNewTypeInt",
+			res.Violations[0].InstanceLocation)
+	})
+
+	t.Run("unsupported schema type", func(t *testing.T) {
+		cred := readCredential(t)
+		cred.CredentialSchema.Type = "JsonSchemaCredential"
+		_, err = jsonProcessor.ValidateCredential(ctx, cred)
+		require.ErrorIs(t, err, processor.ErrUnsupportedSchemaType)
+	})
+
+	t.Run("schema not found", func(t *testing.T) {
+		cred := readCredential(t)
+		cred.CredentialSchema.ID = "ipfs://QmWVYqRNXNRaBmzZYSupMJUW3ZdHB4BVwgVfkRWm1Qhgdq"
+		_, err = jsonProcessor.ValidateCredential(ctx, cred)
+		require.ErrorContains(t, err,
+			"can't load credential schema ipfs://QmWVYqRNXNRaBmzZYSupMJUW3ZdHB4BVwgVfkRWm1Qhgdq")
+	})
+}
+
+func TestSchemaMetadata(t *testing.T) {
+	ipfsCli := tst.MockIPFSClient{
+		"QmSchemaDeliveryAddress":                        "testdata/schema-delivery-address.json",
+		"QmdH1Vu79p2NcZLFbHxzJnLuUHJiMZnBeT7SNpLaqK7k9X": "../../json/testdata/schema-delivery-address.json-ld",
+		"QmKYCContext":                                   "../../merklize/testdata/kyc-v102.jsonld",
+	}
+	loader := loaders.NewDocumentLoader(ipfsCli, "")
+	jsonProcessor := New(processor.WithDocumentLoader(loader))
+	ctx := context.Background()
+
+	md, err := jsonProcessor.LoadSchemaMetadata(ctx,
+		"ipfs://QmSchemaDeliveryAddress")
+	require.NoError(t, err)
+	require.Equal(t, processor.SchemaMetadata{
+		URIs: processor.SchemaURIs{
+			JSONLDContext: "ipfs://QmdH1Vu79p2NcZLFbHxzJnLuUHJiMZnBeT7SNpLaqK7k9X",
+		},
+		Version: "1.0",
+		Type:    "DeliverAddressMultiTestForked",
+	}, md)
+
+	ldContext, err := jsonProcessor.LoadSchemaContext(ctx, md)
+	require.NoError(t, err)
+	require.Contains(t, string(ldContext), "DeliverAddressMultiTestForked")
+
+	merklized, err := jsonProcessor.IsMerklized(ctx, md)
+	require.NoError(t, err)
+	require.False(t, merklized)
+
+	merklized, err = jsonProcessor.IsMerklized(ctx, processor.SchemaMetadata{
+		URIs: processor.SchemaURIs{JSONLDContext: "ipfs://QmKYCContext"},
+		Type: "KYCAgeCredential",
+	})
+	require.NoError(t, err)
+	require.True(t, merklized)
+
+	_, err = jsonProcessor.IsMerklized(ctx, processor.SchemaMetadata{
+		URIs: processor.SchemaURIs{JSONLDContext: "ipfs://QmKYCContext"},
+	})
+	require.EqualError(t, err, "schema has no $metadata.type")
+
+	_, err = jsonProcessor.LoadSchemaContext(ctx, processor.SchemaMetadata{})
+	require.EqualError(t, err, "schema has no $metadata.uris.jsonLdContext")
+}
+
+func TestParseSchemaMetadata_LegacySerialization(t *testing.T) {
+	md, err := processor.ParseSchemaMetadata([]byte(`{
+  "$metadata": {
+    "uris": {
+      "jsonLdContext": "https://schema.iden3.io/core/jsonld/auth.jsonld",
+      "jsonSchema": "https://schema.iden3.io/core/json/auth.json"
+    },
+    "serialization": {
+      "indexDataSlotA": "x",
+      "indexDataSlotB": "y"
+    }
+  }
+}`))
+	require.NoError(t, err)
+	require.Equal(t, "https://schema.iden3.io/core/json/auth.json",
+		md.URIs.JSONSchema)
+	require.NotNil(t, md.Serialization)
+	require.Equal(t, verifiable.SlotsPaths{IndexAPath: "x", IndexBPath: "y"},
+		md.Serialization.SlotsPaths())
+
+	merklized, err := New().IsMerklized(context.Background(), md)
+	require.NoError(t, err)
+	require.False(t, merklized)
 }
@@ -3,8 +3,11 @@ package processor
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
 
 	core "github.com/iden3/go-iden3-core/v2"
+	"github.com/iden3/go-schema-processor/v2/loaders"
 	"github.com/iden3/go-schema-processor/v2/verifiable"
 	"github.com/piprate/json-gold/ld"
 	"github.com/pkg/errors"
@@ -22,6 +25,55 @@ type Validator interface {
 	ValidateData(data, schema []byte) error
 }
 
+// ValidationError is returned by Validator.ValidateData when data does not
+// conform to the schema. It lists all violations found in the data.
+type ValidationError struct {
+	Violations []Violation `json:"violations"`
+}
+
+// Error returns all violations joined into one string
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.String()
+	}
+	return "data validation failed: " + strings.Join(msgs, "; ")
+}
+
+// ValidationResult is the result of Processor.ValidateCredential
+type ValidationResult struct {
+	// Valid is true if the credential conforms to its schema
+	Valid bool `json:"valid"`
+	// SchemaID and SchemaType are copied from credentialSchema of the
+	// credential
+	SchemaID   string `json:"schemaId"`
+	SchemaType string `json:"schemaType"`
+	// Violations lists all reasons why the credential is not valid
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Violation describes a single reason why data failed validation
+type Violation struct {
+	// InstanceLocation is a JSON pointer to the invalid value in the data,
+	// e.g. /credentialSubject/birthday. Empty string points to the root.
+	InstanceLocation string `json:"instanceLocation"`
+	// Keyword is the schema keyword that failed, e.g. required or type.
+	Keyword string `json:"keyword"`
+	// KeywordLocation is a JSON pointer to the keyword following the
+	// evaluation path, including $ref jumps.
+	KeywordLocation string `json:"keywordLocation"`
+	// SchemaLocation is the location of the keyword in the schema document
+	// it is defined in. For the validated schema itself it is a fragment like
+	// #/properties/id/type, for referenced schemas it is an absolute URL.
+	SchemaLocation string `json:"schemaLocation"`
+	// Message is a human-readable description of the violation.
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("'#%s': %s", v.InstanceLocation, v.Message)
+}
+
 // Parser is an interface to parse claim slots
 type Parser interface {
 	// Deprecated: use credential.ToCoreClaim instead
@@ -38,6 +90,11 @@ var (
 	errParserNotDefined    = errors.New("parser is not defined")
 	errLoaderNotDefined    = errors.New("loader is not defined")
 	errValidatorNotDefined = errors.New("validator is not defined")
+	errSchemaIDIsEmpty     = errors.New("credential schema id is empty")
+
+	// ErrUnsupportedSchemaType is returned by ValidateCredential when
+	// credentialSchema.type is not a JSON schema type.
+	ErrUnsupportedSchemaType = errors.New("unsupported credential schema type")
 )
 
 // Opt returns configuration options for processor suite
@@ -77,7 +134,7 @@ func (s *Processor) Load(ctx context.Context, url string) (schema []byte, err er
 	if s.DocumentLoader == nil {
 		return nil, errLoaderNotDefined
 	}
-	doc, err := s.DocumentLoader.LoadDocument(url)
+	doc, err := loaders.BindContext(ctx, s.DocumentLoader).LoadDocument(url)
 	if err != nil {
 		return nil, err
 	}
@@ -112,3 +169,59 @@ func (s *Processor) ValidateData(data, schema []byte) error {
 	}
 	return s.Validator.ValidateData(data, schema)
 }
+
+// ValidateCredential loads the JSON schema from credential.CredentialSchema.ID
+// with the DocumentLoader and validates the credential against it. Only
+// JsonSchema2023 and JsonSchemaValidator2018 schema types are supported,
+// ErrUnsupportedSchemaType is returned for others.
+//
+// If the credential does not conform to the schema, the result is not valid
+// and lists violations, the error is nil. The error is returned if the
+// credential can't be validated, e.g. the schema can't be loaded. Errors of
+// validators that do not return *ValidationError are returned as is.
+func (s *Processor) ValidateCredential(ctx context.Context,
+	credential verifiable.W3CCredential) (*ValidationResult, error) {
+
+	if s.Validator == nil {
+		return nil, errValidatorNotDefined
+	}
+
+	switch credential.CredentialSchema.Type {
+	case verifiable.JSONSchema2023, verifiable.JSONSchemaValidator2018:
+	default:
+		return nil, errors.Wrapf(ErrUnsupportedSchemaType, "%q",
+			credential.CredentialSchema.Type)
+	}
+
+	if credential.CredentialSchema.ID == "" {
+		return nil, errSchemaIDIsEmpty
+	}
+
+	schema, err := s.Load(ctx, credential.CredentialSchema.ID)
+	if err != nil {
+		return nil, errors.WithMessagef(err,
+			"can't load credential schema %v", credential.CredentialSchema.ID)
+	}
+
+	credentialBytes, err := json.Marshal(credential)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ValidationResult{
+		Valid:      true,
+		SchemaID:   credential.CredentialSchema.ID,
+		SchemaType: credential.CredentialSchema.Type,
+	}
+	err = s.Validator.ValidateData(credentialBytes, schema)
+	var validationErr *ValidationError
+	switch {
+	case err == nil:
+	case errors.As(err, &validationErr):
+		result.Valid = false
+		result.Violations = validationErr.Violations
+	default:
+		return nil, err
+	}
+	return result, nil
+}
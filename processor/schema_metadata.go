@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/iden3/go-schema-processor/v2/loaders"
+	"github.com/iden3/go-schema-processor/v2/verifiable"
+	"github.com/piprate/json-gold/ld"
+	"github.com/pkg/errors"
+)
+
+var (
+	errNoJSONLDContextURI = errors.New("schema has no $metadata.uris.jsonLdContext")
+	errNoSchemaType       = errors.New("schema has no $metadata.type")
+)
+
+// SchemaMetadata is the $metadata block of the credential JSON schema
+type SchemaMetadata struct {
+	URIs    SchemaURIs `json:"uris"`
+	Version string     `json:"version,omitempty"`
+	// Type is the credential type described by the schema, it must be
+	// defined in the JSON-LD context
+	Type string `json:"type,omitempty"`
+	// Serialization is the legacy way to describe data slots of
+	// non-merklized claims. New schemas use iden3_serialization attribute of
+	// the JSON-LD context instead.
+	Serialization *SchemaSerialization `json:"serialization,omitempty"`
+}
+
+// SchemaURIs are links to documents related to the JSON schema
+type SchemaURIs struct {
+	JSONLDContext string `json:"jsonLdContext"`
+	JSONSchema    string `json:"jsonSchema,omitempty"`
+}
+
+// SchemaSerialization maps data slots of the core claim to credentialSubject
+// fields
+type SchemaSerialization struct {
+	IndexDataSlotA string `json:"indexDataSlotA,omitempty"`
+	IndexDataSlotB string `json:"indexDataSlotB,omitempty"`
+	ValueDataSlotA string `json:"valueDataSlotA,omitempty"`
+	ValueDataSlotB string `json:"valueDataSlotB,omitempty"`
+}
+
+// SlotsPaths converts legacy serialization to slot paths
+func (s SchemaSerialization) SlotsPaths() verifiable.SlotsPaths {
+	return verifiable.SlotsPaths{
+		IndexAPath: s.IndexDataSlotA,
+		IndexBPath: s.IndexDataSlotB,
+		ValueAPath: s.ValueDataSlotA,
+		ValueBPath: s.ValueDataSlotB,
+	}
+}
+
+// ParseSchemaMetadata reads $metadata block from the JSON schema. Zero value
+// is returned if the schema has no $metadata.
+func ParseSchemaMetadata(schema []byte) (SchemaMetadata, error) {
+	var doc struct {
+		Metadata SchemaMetadata `json:"$metadata"`
+	}
+	err := json.Unmarshal(schema, &doc)
+	if err != nil {
+		return SchemaMetadata{}, err
+	}
+	return doc.Metadata, nil
+}
+
+// LoadSchemaMetadata loads the JSON schema by url and returns its $metadata
+func (s *Processor) LoadSchemaMetadata(ctx context.Context,
+	url string) (SchemaMetadata, error) {
+
+	schema, err := s.Load(ctx, url)
+	if err != nil {
+		return SchemaMetadata{}, err
+	}
+	return ParseSchemaMetadata(schema)
+}
+
+// LoadSchemaContext loads the JSON-LD context referenced by
+// $metadata.uris.jsonLdContext
+func (s *Processor) LoadSchemaContext(ctx context.Context,
+	metadata SchemaMetadata) ([]byte, error) {
+
+	if metadata.URIs.JSONLDContext == "" {
+		return nil, errNoJSONLDContextURI
+	}
+	return s.Load(ctx, metadata.URIs.JSONLDContext)
+}
+
+// IsMerklized reports if credentials of the schema are issued as merklized
+// claims. Schema with legacy $metadata.serialization is never merklized.
+// Otherwise the JSON-LD context is loaded and the type from $metadata.type is
+// merklized if it has no iden3_serialization attribute.
+func (s *Processor) IsMerklized(ctx context.Context,
+	metadata SchemaMetadata) (bool, error) {
+
+	if metadata.Serialization != nil {
+		return false, nil
+	}
+	if metadata.Type == "" {
+		return false, errNoSchemaType
+	}
+
+	ldContext, err := s.LoadSchemaContext(ctx, metadata)
+	if err != nil {
+		return false, err
+	}
+
+	opts := ld.NewJsonLdOptions("")
+	opts.DocumentLoader = loaders.BindContext(ctx, s.DocumentLoader)
+	layout, err := verifiable.SlotsLayoutFromContext(ldContext, metadata.Type,
+		opts)
+	if err != nil {
+		return false, err
+	}
+	return layout.Serialization == "", nil
+}
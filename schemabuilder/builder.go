@@ -0,0 +1,376 @@
+package schemabuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/iden3/go-schema-processor/v2/verifiable"
+	"github.com/pkg/errors"
+)
+
+const (
+	jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+	xsdNS           = "http://www.w3.org/2001/XMLSchema#"
+	vocabPrefix     = "vocab"
+	defaultVersion  = "1.0"
+)
+
+// FieldType is a type of credentialSubject field
+type FieldType string
+
+// Supported field types
+const (
+	String             FieldType = "string"
+	Integer            FieldType = "integer"
+	PositiveInteger    FieldType = "positiveInteger"
+	NonNegativeInteger FieldType = "nonNegativeInteger"
+	Number             FieldType = "number"
+	Boolean            FieldType = "boolean"
+	DateTime           FieldType = "dateTime"
+	Object             FieldType = "object"
+)
+
+// Type is a declarative description of the credential type
+type Type struct {
+	// Name is the name of the credential type, e.g. KYCAgeCredential
+	Name string
+	// ID is the @id of the type in the JSON-LD context. If empty, it is
+	// ContextURL#Name.
+	ID string
+	// Vocab is the IRI prefix for field @ids. If empty, it is the ID without
+	// fragment followed by #.
+	Vocab string
+	// ContextURL is the URL the JSON-LD context would be published at. It is
+	// written to $metadata.uris.jsonLdContext of the JSON schema.
+	ContextURL string
+	// Version is the version of the schema, 1.0 by default
+	Version     string
+	Title       string
+	Description string
+	// Fields are the fields of credentialSubject. The id field is added
+	// automatically.
+	Fields []Field
+}
+
+// Field is a description of the credentialSubject field
+type Field struct {
+	Name        string
+	Type        FieldType
+	Title       string
+	Description string
+	Required    bool
+	// Fields are nested fields of the field with Object type
+	Fields []Field
+	// Slot is an optional claim data slot the field is serialized to:
+	// verifiable.SlotIndexA, verifiable.SlotIndexB, verifiable.SlotValueA or
+	// verifiable.SlotValueB. If any field has a slot, the type is
+	// non-merklized.
+	Slot string
+}
+
+// Documents are generated JSON schema and JSON-LD context
+type Documents struct {
+	JSONSchema    []byte
+	JSONLDContext []byte
+}
+
+type fieldTypeInfo struct {
+	jsonSchema map[string]any
+	xsdType    string
+}
+
+var fieldTypes = map[FieldType]fieldTypeInfo{
+	String:             {map[string]any{"type": "string"}, "string"},
+	Integer:            {map[string]any{"type": "integer"}, "integer"},
+	PositiveInteger:    {map[string]any{"type": "integer", "minimum": 1}, "positiveInteger"},
+	NonNegativeInteger: {map[string]any{"type": "integer", "minimum": 0}, "nonNegativeInteger"},
+	Number:             {map[string]any{"type": "number"}, "double"},
+	Boolean:            {map[string]any{"type": "boolean"}, "boolean"},
+	DateTime:           {map[string]any{"type": "string", "format": "date-time"}, "dateTime"},
+}
+
+var slotOrder = []string{
+	verifiable.SlotIndexA,
+	verifiable.SlotIndexB,
+	verifiable.SlotValueA,
+	verifiable.SlotValueB,
+}
+
+// Build generates the JSON schema and the JSON-LD context for the type
+func Build(t Type) (Documents, error) {
+	if t.Name == "" {
+		return Documents{}, errors.New("type name is empty")
+	}
+
+	typeID := t.ID
+	if typeID == "" {
+		if t.ContextURL == "" {
+			return Documents{}, errors.New(
+				"type id is empty and context URL is not set")
+		}
+		typeID = t.ContextURL + "#" + t.Name
+	}
+
+	vocab := t.Vocab
+	if vocab == "" {
+		vocab = typeID
+		if i := strings.IndexByte(vocab, '#'); i != -1 {
+			vocab = vocab[:i]
+		}
+		vocab += "#"
+	}
+
+	slots := make(map[string]string)
+	subjectProps, subjectRequired, fieldsCtx, err := buildFields(t.Fields,
+		"", slots)
+	if err != nil {
+		return Documents{}, err
+	}
+
+	typeCtx := map[string]any{
+		"@propagate": true,
+		"@protected": true,
+		vocabPrefix:  vocab,
+		"xsd":        xsdNS,
+	}
+	for k, v := range fieldsCtx {
+		typeCtx[k] = v
+	}
+	if len(slots) != 0 {
+		typeCtx["iden3_serialization"] = serializationAttr(slots)
+	}
+
+	ldCtx := map[string]any{
+		"@context": []any{
+			map[string]any{
+				"@protected": true,
+				"@version":   1.1,
+				"id":         "@id",
+				"type":       "@type",
+				t.Name: map[string]any{
+					"@id":      typeID,
+					"@context": typeCtx,
+				},
+			},
+		},
+	}
+
+	ldCtxBytes, err := json.MarshalIndent(ldCtx, "", "  ")
+	if err != nil {
+		return Documents{}, err
+	}
+
+	schemaBytes, err := json.MarshalIndent(
+		jsonSchema(t, subjectProps, subjectRequired), "", "  ")
+	if err != nil {
+		return Documents{}, err
+	}
+
+	return Documents{JSONSchema: schemaBytes, JSONLDContext: ldCtxBytes}, nil
+}
+
+// buildFields returns JSON schema properties, list of required fields and
+// JSON-LD term definitions for the fields. Slots assigned to fields are
+// collected into slots map.
+func buildFields(fields []Field, pathPrefix string,
+	slots map[string]string) (map[string]any, []string, map[string]any,
+	error) {
+
+	props := make(map[string]any, len(fields))
+	ctx := make(map[string]any, len(fields))
+	var required []string
+
+	for _, f := range fields {
+		path := pathPrefix + f.Name
+
+		switch {
+		case f.Name == "":
+			return nil, nil, nil, errors.New("field name is empty")
+		case f.Name == "id" || f.Name == "type" ||
+			strings.HasPrefix(f.Name, "@"):
+			return nil, nil, nil, fmt.Errorf("field name %v is reserved",
+				path)
+		case strings.Contains(f.Name, "."):
+			return nil, nil, nil, fmt.Errorf(
+				"field name %v should not contain dots", path)
+		}
+		if _, ok := props[f.Name]; ok {
+			return nil, nil, nil, fmt.Errorf("duplicate field %v", path)
+		}
+
+		var prop map[string]any
+		termDef := map[string]any{"@id": vocabPrefix + ":" + f.Name}
+
+		if f.Type == Object {
+			if f.Slot != "" {
+				return nil, nil, nil, fmt.Errorf(
+					"object field %v can't be serialized to slot", path)
+			}
+			nestedProps, nestedRequired, nestedCtx, err := buildFields(
+				f.Fields, path+".", slots)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			prop = map[string]any{
+				"type":       "object",
+				"properties": nestedProps,
+			}
+			if len(nestedRequired) != 0 {
+				prop["required"] = nestedRequired
+			}
+			termDef["@context"] = nestedCtx
+		} else {
+			tpInfo, ok := fieldTypes[f.Type]
+			if !ok {
+				return nil, nil, nil, fmt.Errorf(
+					"unsupported type %q of field %v", f.Type, path)
+			}
+			if len(f.Fields) != 0 {
+				return nil, nil, nil, fmt.Errorf(
+					"field %v of type %v can't have nested fields", path,
+					f.Type)
+			}
+			prop = make(map[string]any, len(tpInfo.jsonSchema)+2)
+			for k, v := range tpInfo.jsonSchema {
+				prop[k] = v
+			}
+			termDef["@type"] = "xsd:" + tpInfo.xsdType
+
+			if f.Slot != "" {
+				err := assignSlot(slots, f.Slot, path)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+			}
+		}
+
+		if f.Title != "" {
+			prop["title"] = f.Title
+		}
+		if f.Description != "" {
+			prop["description"] = f.Description
+		}
+		if f.Required {
+			required = append(required, f.Name)
+		}
+
+		props[f.Name] = prop
+		ctx[f.Name] = termDef
+	}
+
+	return props, required, ctx, nil
+}
+
+func assignSlot(slots map[string]string, slot, path string) error {
+	found := false
+	for _, s := range slotOrder {
+		if s == slot {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown slot %v of field %v", slot, path)
+	}
+	if other, ok := slots[slot]; ok {
+		return fmt.Errorf("slot %v is assigned to both %v and %v", slot,
+			other, path)
+	}
+	slots[slot] = path
+	return nil
+}
+
+func serializationAttr(slots map[string]string) string {
+	parts := make([]string, 0, len(slots))
+	for _, s := range slotOrder {
+		if path, ok := slots[s]; ok {
+			parts = append(parts, s+"="+path)
+		}
+	}
+	return "iden3:v1:" + strings.Join(parts, "&")
+}
+
+func jsonSchema(t Type, subjectProps map[string]any,
+	subjectRequired []string) map[string]any {
+
+	version := t.Version
+	if version == "" {
+		version = defaultVersion
+	}
+
+	subjectProps["id"] = map[string]any{
+		"title":       "Credential subject ID",
+		"description": "Stores the DID of the subject that owns the credential",
+		"type":        "string",
+		"format":      "uri",
+	}
+
+	credentialSubject := map[string]any{
+		"title":       "Credential subject",
+		"description": "Stores the data of the credential",
+		"type":        "object",
+		"properties":  subjectProps,
+	}
+	if len(subjectRequired) != 0 {
+		credentialSubject["required"] = subjectRequired
+	}
+
+	metadata := map[string]any{
+		"version": version,
+		"type":    t.Name,
+	}
+	if t.ContextURL != "" {
+		metadata["uris"] = map[string]any{"jsonLdContext": t.ContextURL}
+	}
+
+	schema := map[string]any{
+		"$schema":   jsonSchemaDraft,
+		"$metadata": metadata,
+		"type":      "object",
+		"properties": map[string]any{
+			"@context": map[string]any{
+				"type": []string{"string", "array", "object"},
+			},
+			"id": map[string]any{"type": "string"},
+			"type": map[string]any{
+				"type":  []string{"string", "array"},
+				"items": map[string]any{"type": "string"},
+			},
+			"issuer": map[string]any{
+				"type":   []string{"string", "object"},
+				"format": "uri",
+				"properties": map[string]any{
+					"id": map[string]any{"type": "string", "format": "uri"},
+				},
+				"required": []string{"id"},
+			},
+			"issuanceDate": map[string]any{
+				"type":   "string",
+				"format": "date-time",
+			},
+			"expirationDate": map[string]any{
+				"type":   "string",
+				"format": "date-time",
+			},
+			"credentialSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"id":   map[string]any{"type": "string", "format": "uri"},
+					"type": map[string]any{"type": "string"},
+				},
+				"required": []string{"id", "type"},
+			},
+			"credentialSubject": credentialSubject,
+		},
+		"required": []string{"@context", "id", "issuanceDate", "issuer",
+			"type", "credentialSchema", "credentialSubject"},
+	}
+	if t.Title != "" {
+		schema["title"] = t.Title
+	}
+	if t.Description != "" {
+		schema["description"] = t.Description
+	}
+	return schema
+}
@@ -0,0 +1,255 @@
+package schemabuilder
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	jsonproc "github.com/iden3/go-schema-processor/v2/json"
+	"github.com/iden3/go-schema-processor/v2/loaders"
+	"github.com/iden3/go-schema-processor/v2/merklize"
+	tst "github.com/iden3/go-schema-processor/v2/testing"
+	"github.com/iden3/go-schema-processor/v2/verifiable"
+	"github.com/piprate/json-gold/ld"
+	"github.com/stretchr/testify/require"
+)
+
+const testContextURL = "https://example.com/delivery-address.jsonld"
+
+var testType = Type{
+	Name:        "DeliveryAddress",
+	ContextURL:  testContextURL,
+	Title:       "Delivery address",
+	Description: "Delivery address of the subject",
+	Fields: []Field{
+		{Name: "price", Type: Number, Required: true, Slot: verifiable.SlotIndexA},
+		{Name: "operatorId", Type: PositiveInteger, Slot: verifiable.SlotIndexB},
+		{Name: "deliveryTime", Type: DateTime},
+		{Name: "country", Type: String, Description: "Country code"},
+		{
+			Name:     "postalProviderInformation",
+			Type:     Object,
+			Required: true,
+			Fields: []Field{
+				{Name: "insured", Type: Boolean, Required: true, Slot: verifiable.SlotValueB},
+				{Name: "weight", Type: Number},
+			},
+		},
+	},
+}
+
+const testCredential = `{
+  "id": "urn:uuid:a4b3fd1f-0d41-4b29-a33e-5b2dcc6b0a38",
+  "@context": [
+    "https://www.w3.org/2018/credentials/v1",
+    "https://example.com/delivery-address.jsonld"
+  ],
+  "type": ["VerifiableCredential", "DeliveryAddress"],
+  "issuanceDate": "2023-06-19T08:47:29Z",
+  "issuer": "did:polygonid:polygon:mumbai:2qLPqvayNQz9TA2r5VPxUugoF18teGU583zJ859wfy",
+  "credentialSchema": {
+    "id": "https://example.com/delivery-address.json",
+    "type": "JsonSchemaValidator2018"
+  },
+  "credentialSubject": {
+    "type": "DeliveryAddress",
+    "price": 123.52,
+    "operatorId": 5,
+    "deliveryTime": "2023-06-20T10:00:00Z",
+    "postalProviderInformation": {
+      "insured": true,
+      "weight": 1.3
+    }
+  }
+}`
+
+func TestBuild(t *testing.T) {
+	docs, err := Build(testType)
+	require.NoError(t, err)
+
+	t.Run("JSON schema", func(t *testing.T) {
+		var schema map[string]any
+		err := json.Unmarshal(docs.JSONSchema, &schema)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{
+			"uris":    map[string]any{"jsonLdContext": testContextURL},
+			"version": "1.0",
+			"type":    "DeliveryAddress",
+		}, schema["$metadata"])
+
+		v := jsonproc.Validator{}
+		err = v.ValidateData([]byte(testCredential), docs.JSONSchema)
+		require.NoError(t, err)
+
+		err = v.ValidateData([]byte(`{"credentialSubject": {"price": 1}}`),
+			docs.JSONSchema)
+		require.ErrorContains(t, err,
+			"'#/credentialSubject': missing properties: 'postalProviderInformation'")
+	})
+
+	t.Run("JSON-LD context", func(t *testing.T) {
+		typeID, err := merklize.TypeIDFromContext(docs.JSONLDContext,
+			"DeliveryAddress")
+		require.NoError(t, err)
+		require.Equal(t, testContextURL+"#DeliveryAddress", typeID)
+
+		var ctxDoc map[string]any
+		err = json.Unmarshal(docs.JSONLDContext, &ctxDoc)
+		require.NoError(t, err)
+		ldCtx, err := ld.NewContext(nil, nil).Parse(ctxDoc["@context"])
+		require.NoError(t, err)
+		serAttr, err := verifiable.GetSerializationAttrFromParsedContext(
+			ldCtx, "DeliveryAddress")
+		require.NoError(t, err)
+		require.Equal(t,
+			"iden3:v1:slotIndexA=price&slotIndexB=operatorId&slotValueB=postalProviderInformation.insured",
+			serAttr)
+
+		slotIndex, err := jsonproc.Parser{}.GetFieldSlotIndex(
+			"postalProviderInformation.insured", "DeliveryAddress",
+			docs.JSONLDContext)
+		require.NoError(t, err)
+		require.Equal(t, 7, slotIndex)
+
+		layout, err := verifiable.SlotsLayoutFromContext(docs.JSONLDContext,
+			"DeliveryAddress", nil)
+		require.NoError(t, err)
+		require.Equal(t, ld.XSDDouble, layout.Slots[0].Datatype)
+		require.Equal(t, ld.XSDNS+"positiveInteger",
+			layout.Slots[1].Datatype)
+		require.Equal(t, ld.XSDBoolean, layout.Slots[2].Datatype)
+
+		fieldType, err := merklize.TypeFromContext(docs.JSONLDContext,
+			"DeliveryAddress.deliveryTime")
+		require.NoError(t, err)
+		require.Equal(t, ld.XSDNS+"dateTime", fieldType)
+	})
+
+	t.Run("core claim", func(t *testing.T) {
+		defer tst.MockHTTPClient(t, map[string]string{
+			"https://www.w3.org/2018/credentials/v1": "../merklize/testdata/httpresp/credentials-v1.jsonld",
+		}, tst.IgnoreUntouchedURLs())()
+
+		cacheEngine, err := loaders.NewMemoryCacheEngine(
+			loaders.WithEmbeddedDocumentBytes(testContextURL,
+				docs.JSONLDContext))
+		require.NoError(t, err)
+		docLoader := loaders.NewDocumentLoader(nil, "",
+			loaders.WithCacheEngine(cacheEngine))
+
+		var cred verifiable.W3CCredential
+		err = json.Unmarshal([]byte(testCredential), &cred)
+		require.NoError(t, err)
+
+		claim, err := cred.ToCoreClaim(context.Background(),
+			&verifiable.CoreClaimOptions{
+				MerklizerOpts: []merklize.MerklizeOption{
+					merklize.WithDocumentLoader(docLoader)},
+			})
+		require.NoError(t, err)
+
+		values, err := verifiable.DecodeClaimSlots(claim, docs.JSONLDContext,
+			"DeliveryAddress", merklize.Options{DocumentLoader: docLoader})
+		require.NoError(t, err)
+		require.Len(t, values, 3)
+		ok, err := values[0].Matches(123.52)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, big.NewInt(5), values[1].Value)
+		require.Equal(t, true, values[2].Value)
+	})
+}
+
+func TestBuild_Merklized(t *testing.T) {
+	docs, err := Build(Type{
+		Name:   "KYCAgeCredential",
+		ID:     "urn:uuid:8b2a7e5b-5a4b-4bb2-9a7c-1f0b4c5a6f21",
+		Fields: []Field{{Name: "birthday", Type: Integer, Required: true}},
+	})
+	require.NoError(t, err)
+
+	layout, err := verifiable.SlotsLayoutFromContext(docs.JSONLDContext,
+		"KYCAgeCredential", nil)
+	require.NoError(t, err)
+	require.Equal(t, verifiable.SlotsLayout{}, layout)
+
+	p, err := merklize.NewFieldPathFromContext(docs.JSONLDContext,
+		"KYCAgeCredential", "birthday")
+	require.NoError(t, err)
+	require.Equal(t,
+		[]interface{}{"urn:uuid:8b2a7e5b-5a4b-4bb2-9a7c-1f0b4c5a6f21#birthday"},
+		p.Parts())
+
+	var schema map[string]any
+	err = json.Unmarshal(docs.JSONSchema, &schema)
+	require.NoError(t, err)
+	_, hasURIs := schema["$metadata"].(map[string]any)["uris"]
+	require.False(t, hasURIs)
+}
+
+func TestBuild_Errors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		tp      Type
+		wantErr string
+	}{
+		{
+			name:    "no type id",
+			tp:      Type{Name: "T"},
+			wantErr: "type id is empty and context URL is not set",
+		},
+		{
+			name: "duplicate slot",
+			tp: Type{Name: "T", ID: "urn:t", Fields: []Field{
+				{Name: "a", Type: Integer, Slot: verifiable.SlotIndexA},
+				{Name: "b", Type: Integer, Slot: verifiable.SlotIndexA},
+			}},
+			wantErr: "slot slotIndexA is assigned to both a and b",
+		},
+		{
+			name: "unknown slot",
+			tp: Type{Name: "T", ID: "urn:t", Fields: []Field{
+				{Name: "a", Type: Integer, Slot: "slotIndexC"},
+			}},
+			wantErr: "unknown slot slotIndexC of field a",
+		},
+		{
+			name: "object in slot",
+			tp: Type{Name: "T", ID: "urn:t", Fields: []Field{
+				{Name: "a", Type: Object, Slot: verifiable.SlotIndexA},
+			}},
+			wantErr: "object field a can't be serialized to slot",
+		},
+		{
+			name: "unsupported type",
+			tp: Type{Name: "T", ID: "urn:t", Fields: []Field{
+				{Name: "a", Type: "array"},
+			}},
+			wantErr: `unsupported type "array" of field a`,
+		},
+		{
+			name: "reserved name",
+			tp: Type{Name: "T", ID: "urn:t", Fields: []Field{
+				{Name: "o", Type: Object, Fields: []Field{
+					{Name: "id", Type: String},
+				}},
+			}},
+			wantErr: "field name o.id is reserved",
+		},
+		{
+			name: "duplicate field",
+			tp: Type{Name: "T", ID: "urn:t", Fields: []Field{
+				{Name: "a", Type: String},
+				{Name: "a", Type: Integer},
+			}},
+			wantErr: "duplicate field a",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Build(tc.tp)
+			require.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package testing
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// MockIPFSClient serves IPFS paths from local files. It maps IPFS paths to
+// file names.
+type MockIPFSClient map[string]string
+
+func (m MockIPFSClient) Cat(url string) (io.ReadCloser, error) {
+	fName, ok := m[url]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return os.Open(fName)
+}
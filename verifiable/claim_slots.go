@@ -0,0 +1,147 @@
+package verifiable
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	core "github.com/iden3/go-iden3-core/v2"
+	"github.com/iden3/go-schema-processor/v2/merklize"
+	"github.com/iden3/go-schema-processor/v2/utils"
+	"github.com/piprate/json-gold/ld"
+	"github.com/pkg/errors"
+)
+
+// ClaimSlotValue is the value of claim data slot decoded according to the
+// slots layout of the credential type
+type ClaimSlotValue struct {
+	SlotLayout
+	// Raw is the slot value as a field element
+	Raw *big.Int
+	// Value is the decoded value: *big.Int for XSD integer types and bool for
+	// xsd:boolean. It is nil for strings, doubles, datetimes and other hashed
+	// values, use Matches to compare them with candidate values.
+	Value any
+
+	hasher merklize.Hasher
+}
+
+// Matches reports if the candidate value is serialized to the same field
+// element as the slot value. The candidate is hashed according to the field
+// datatype the same way as for the credential, e.g. for xsd:dateTime the
+// candidate should be a string in RFC3339 format.
+func (v ClaimSlotValue) Matches(candidate any) (bool, error) {
+	h := v.hasher
+	if h == nil {
+		h = merklize.PoseidonHasher{}
+	}
+
+	candidateInt, err := merklize.HashValueWithHasher(h, v.Datatype,
+		candidate)
+	if err != nil {
+		return false, err
+	}
+	return candidateInt.Cmp(v.Raw) == 0, nil
+}
+
+// DecodeClaimSlots reads iden3_serialization attribute of the type from the
+// JSON-LD context document and returns values of serialized data slots of
+// the claim. Type may be given either by name or by id. The schema hash of the
+// claim must match the type.
+func DecodeClaimSlots(claim *core.Claim, ctxBytes []byte, typeName string,
+	opts merklize.Options) ([]ClaimSlotValue, error) {
+
+	var ctxDoc map[string]any
+	err := json.Unmarshal(ctxBytes, &ctxDoc)
+	if err != nil {
+		return nil, err
+	}
+	ctxObj, ok := ctxDoc[contextFullKey]
+	if !ok {
+		return nil, errors.New("document has no @context")
+	}
+	ldCtx, err := ld.NewContext(nil, opts.JSONLDOptions()).Parse(ctxObj)
+	if err != nil {
+		return nil, err
+	}
+
+	layout, err := SlotsLayoutFromParsedContext(ldCtx, typeName)
+	if err != nil {
+		return nil, err
+	}
+	if layout.Serialization == "" {
+		return nil, fmt.Errorf("type %v is merklized, claim has no "+
+			"serialized slots", typeName)
+	}
+
+	// type may be given by name, resolve it to id to check the schema hash
+	typeID, err := findTypeID(ldCtx, typeName)
+	if err != nil {
+		return nil, err
+	}
+	if claim.GetSchemaHash() != utils.CreateSchemaHash([]byte(typeID)) {
+		return nil, errors.New("claim schema hash does not match the type")
+	}
+
+	h := opts.Hasher
+	if h == nil {
+		h = merklize.PoseidonHasher{}
+	}
+
+	rawSlots := claim.RawSlotsAsInts()
+	values := make([]ClaimSlotValue, 0, len(layout.Slots))
+	for _, slot := range layout.Slots {
+		v := ClaimSlotValue{
+			SlotLayout: slot,
+			Raw:        rawSlots[slot.SlotIndex],
+			hasher:     h,
+		}
+		v.Value, err = decodeSlotValue(h, slot.Datatype, v.Raw)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "can't decode field %v",
+				slot.Field)
+		}
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+// decodeSlotValue reverses serialization done by fillSlot for integers and
+// booleans. Other values are hashes and can't be decoded.
+func decodeSlotValue(h merklize.Hasher, datatype string,
+	raw *big.Int) (any, error) {
+
+	switch datatype {
+	case ld.XSDBoolean:
+		for _, b := range []bool{false, true} {
+			bInt, err := merklize.HashValueWithHasher(h, datatype, b)
+			if err != nil {
+				return nil, err
+			}
+			if bInt.Cmp(raw) == 0 {
+				return b, nil
+			}
+		}
+		return nil, errors.New("slot value is not a boolean")
+
+	case ld.XSDNS + "positiveInteger",
+		ld.XSDNS + "nonNegativeInteger":
+
+		return new(big.Int).Set(raw), nil
+
+	case ld.XSDInteger,
+		ld.XSDNS + "negativeInteger",
+		ld.XSDNS + "nonPositiveInteger":
+
+		// negative values are stored as prime + value
+		maxValue := new(big.Int).Div(h.Prime(), big.NewInt(2))
+		if raw.Cmp(maxValue) > 0 {
+			return new(big.Int).Sub(raw, h.Prime()), nil
+		}
+		return new(big.Int).Set(raw), nil
+
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,143 @@
+package verifiable
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"os"
+	"testing"
+
+	core "github.com/iden3/go-iden3-core/v2"
+	"github.com/iden3/go-schema-processor/v2/merklize"
+	tst "github.com/iden3/go-schema-processor/v2/testing"
+	"github.com/iden3/go-schema-processor/v2/utils"
+	"github.com/piprate/json-gold/ld"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeClaimSlots(t *testing.T) {
+	defer tst.MockHTTPClient(t,
+		map[string]string{
+			"https://www.w3.org/2018/credentials/v1":              "../merklize/testdata/httpresp/credentials-v1.jsonld",
+			"https://example.com/schema-delivery-address.json-ld": "../json/testdata/schema-delivery-address.json-ld",
+		},
+		tst.IgnoreUntouchedURLs())()
+
+	credentialBytes, err := os.ReadFile("../json/testdata/non-merklized-1.json-ld")
+	require.NoError(t, err)
+	var credential W3CCredential
+	err = json.Unmarshal(credentialBytes, &credential)
+	require.NoError(t, err)
+
+	claim, err := credential.ToCoreClaim(context.Background(), nil)
+	require.NoError(t, err)
+
+	ctxBytes, err := os.ReadFile("../json/testdata/schema-delivery-address.json-ld")
+	require.NoError(t, err)
+
+	for _, typeName := range []string{
+		"DeliverAddressMultiTestForked",
+		"urn:uuid:ac2ede19-b3b9-454d-b1a9-a7b3d5763100",
+	} {
+		values, err := DecodeClaimSlots(claim, ctxBytes, typeName,
+			merklize.Options{})
+		require.NoError(t, err)
+		require.Len(t, values, 2)
+
+		require.Equal(t, "price", values[0].Field)
+		require.Equal(t, 2, values[0].SlotIndex)
+		require.Nil(t, values[0].Value)
+		ok, err := values[0].Matches("123.52")
+		require.NoError(t, err)
+		require.True(t, ok)
+		ok, err = values[0].Matches(123.52)
+		require.NoError(t, err)
+		require.True(t, ok)
+		ok, err = values[0].Matches("123.53")
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		require.Equal(t, "postalProviderInformation.insured", values[1].Field)
+		require.Equal(t, 7, values[1].SlotIndex)
+		require.Equal(t, true, values[1].Value)
+		ok, err = values[1].Matches(true)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	t.Run("schema hash mismatch", func(t *testing.T) {
+		_, err := DecodeClaimSlots(claim, []byte(AuthBJJJsonLDSchema),
+			"AuthBJJCredential", merklize.Options{})
+		require.EqualError(t, err,
+			"claim schema hash does not match the type")
+	})
+}
+
+func TestDecodeClaimSlots_Integers(t *testing.T) {
+	ctx := `{"@context": {
+  "T": {
+    "@id": "urn:uuid:6dff4518-5177-4f39-af58-9c156d9b6309",
+    "@context": {
+      "xsd": "http://www.w3.org/2001/XMLSchema#",
+      "iden3_serialization": "iden3:v1:slotIndexA=a&slotIndexB=b&slotValueA=c",
+      "a": {"@id": "urn:a", "@type": "xsd:integer"},
+      "b": {"@id": "urn:b", "@type": "xsd:positiveInteger"},
+      "c": {"@id": "urn:c", "@type": "xsd:dateTime"}
+    }
+  }
+}}`
+
+	h := merklize.PoseidonHasher{}
+	negative, err := merklize.HashValue(ld.XSDInteger, -5)
+	require.NoError(t, err)
+	dt, err := merklize.HashValue(ld.XSDNS+"dateTime", "2023-06-19T08:47:29Z")
+	require.NoError(t, err)
+
+	claim, err := core.NewClaim(
+		utils.CreateSchemaHash(
+			[]byte("urn:uuid:6dff4518-5177-4f39-af58-9c156d9b6309")),
+		core.WithIndexDataInts(negative, big.NewInt(19960424)),
+		core.WithValueDataInts(dt, nil))
+	require.NoError(t, err)
+
+	values, err := DecodeClaimSlots(claim, []byte(ctx), "T",
+		merklize.Options{Hasher: h})
+	require.NoError(t, err)
+	require.Len(t, values, 3)
+	require.Equal(t, big.NewInt(-5), values[0].Value)
+	require.Equal(t, big.NewInt(19960424), values[1].Value)
+	require.Nil(t, values[2].Value)
+	ok, err := values[2].Matches("2023-06-19T08:47:29Z")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+}
+
+func TestFindTypeID(t *testing.T) {
+	ldCtx, err := ld.NewContext(nil, nil).Parse(map[string]any{
+		"@vocab": "urn:vocab:",
+		"T": map[string]any{
+			"@id":      "urn:uuid:6dff4518-5177-4f39-af58-9c156d9b6309",
+			"@context": map[string]any{},
+		},
+		"V":     map[string]any{"@context": map[string]any{}},
+		"field": map[string]any{"@id": "urn:field"},
+	})
+	require.NoError(t, err)
+
+	for tp, want := range map[string]string{
+		"T": "urn:uuid:6dff4518-5177-4f39-af58-9c156d9b6309",
+		"urn:uuid:6dff4518-5177-4f39-af58-9c156d9b6309": "urn:uuid:" +
+			"6dff4518-5177-4f39-af58-9c156d9b6309",
+		"V": "urn:vocab:V",
+	} {
+		typeID, err := findTypeID(ldCtx, tp)
+		require.NoError(t, err, tp)
+		require.Equal(t, want, typeID, tp)
+	}
+
+	for _, tp := range []string{"U", "field", "urn:field"} {
+		_, err = findTypeID(ldCtx, tp)
+		require.EqualError(t, err, "type "+tp+" not found in context")
+	}
+}
@@ -1,6 +1,7 @@
 package verifiable
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -102,7 +103,7 @@ type parsedSlots struct {
 }
 
 // parseSlots converts payload to claim slots using provided schema
-func parseSlots(mz *merklize.Merklizer,
+func parseSlots(ctx context.Context, mz *merklize.Merklizer,
 	credential W3CCredential,
 	credentialType string) (parsedSlots, bool, error) {
 
@@ -113,7 +114,7 @@ func parseSlots(mz *merklize.Merklizer,
 		ValueB: make([]byte, 32),
 	}
 
-	jsonLDOpts := mz.Options().JSONLDOptions()
+	jsonLDOpts := mz.Options().WithContext(ctx).JSONLDOptions()
 	serAttr, err := getSerializationAttr(credential, jsonLDOpts,
 		credentialType)
 	if err != nil {
@@ -182,14 +183,41 @@ func anySlice[T any](in []T) []any {
 func GetSerializationAttrFromParsedContext(ldCtx *ld.Context,
 	tp string) (string, error) {
 
+	typeCtxM, err := findTypeContext(ldCtx, tp)
+	if err != nil || typeCtxM == nil {
+		return "", err
+	}
+
+	serStr, _ := typeCtxM[serializationFullKey].(string)
+	return serStr, nil
+}
+
+// TypeContextFromParsedContext returns parsed type-scoped @context of the
+// type. Type may be given either by name or by id.
+func TypeContextFromParsedContext(ldCtx *ld.Context,
+	tp string) (*ld.Context, error) {
+
+	typeCtxM, err := findTypeContext(ldCtx, tp)
+	if err != nil {
+		return nil, err
+	}
+	if typeCtxM == nil {
+		return nil, fmt.Errorf("type %v not found in context", tp)
+	}
+	return ldCtx.Parse(typeCtxM)
+}
+
+// findTypeContext returns type-scoped @context of the type either by type
+// name or by type id. Returns nil if type is not found.
+func findTypeContext(ldCtx *ld.Context, tp string) (map[string]any, error) {
 	termDef, ok := ldCtx.AsMap()["termDefinitions"]
 	if !ok {
-		return "", errors.New("types now found in context")
+		return nil, errors.New("types now found in context")
 	}
 
 	termDefM, ok := termDef.(map[string]any)
 	if !ok {
-		return "", errors.New("terms definitions is not of correct type")
+		return nil, errors.New("terms definitions is not of correct type")
 	}
 
 	for typeName, typeDef := range termDefM {
@@ -205,63 +233,87 @@ func GetSerializationAttrFromParsedContext(ldCtx *ld.Context,
 		}
 		typeCtxM, ok := typeCtx.(map[string]any)
 		if !ok {
-			return "", errors.New("type @context is not of correct type")
+			return nil, errors.New("type @context is not of correct type")
 		}
 		typeID, _ := typeDefM["@id"].(string)
 		if typeName != tp && typeID != tp {
 			continue
 		}
 
-		serStr, _ := typeCtxM[serializationFullKey].(string)
-		return serStr, nil
+		return typeCtxM, nil
 	}
 
-	return "", nil
+	return nil, nil
+}
+
+// findTypeID returns @id of the type given either by name or by id
+func findTypeID(ldCtx *ld.Context, tp string) (string, error) {
+	typeCtx, err := findTypeContext(ldCtx, tp)
+	if err != nil {
+		return "", err
+	}
+	if typeCtx == nil {
+		return "", fmt.Errorf("type %v not found in context", tp)
+	}
+
+	termDef := ldCtx.GetTermDefinition(tp)
+	if _, isType := termDef[contextFullKey]; !isType {
+		// the type is given by id
+		return tp, nil
+	}
+	typeID, ok := termDef["@id"].(string)
+	if !ok {
+		return "", fmt.Errorf("@id attribute is not found for type %v", tp)
+	}
+	return typeID, nil
 }
 
-type slotsPaths struct {
+// SlotsPaths contains paths of credentialSubject fields serialized into
+// claim data slots as defined by iden3_serialization attribute.
+type SlotsPaths struct {
 	IndexAPath string
 	IndexBPath string
 	ValueAPath string
 	ValueBPath string
 }
 
-func ParseSerializationAttr(serAttr string) (slotsPaths, error) {
+// ParseSerializationAttr parses iden3_serialization attribute value
+func ParseSerializationAttr(serAttr string) (SlotsPaths, error) {
 	prefix := "iden3:v1:"
 	if !strings.HasPrefix(serAttr, prefix) {
-		return slotsPaths{},
+		return SlotsPaths{},
 			errors.New("serialization attribute does not have correct prefix")
 	}
 	parts := strings.Split(serAttr[len(prefix):], "&")
 	if len(parts) > 4 {
-		return slotsPaths{},
+		return SlotsPaths{},
 			errors.New("serialization attribute has too many parts")
 	}
-	var paths slotsPaths
+	var paths SlotsPaths
 	for _, part := range parts {
 		kv := strings.Split(part, "=")
 		if len(kv) != 2 {
-			return slotsPaths{}, errors.New(
+			return SlotsPaths{}, errors.New(
 				"serialization attribute part does not have correct format")
 		}
 		switch kv[0] {
-		case "slotIndexA":
+		case SlotIndexA:
 			paths.IndexAPath = kv[1]
-		case "slotIndexB":
+		case SlotIndexB:
 			paths.IndexBPath = kv[1]
-		case "slotValueA":
+		case SlotValueA:
 			paths.ValueAPath = kv[1]
-		case "slotValueB":
+		case SlotValueB:
 			paths.ValueBPath = kv[1]
 		default:
-			return slotsPaths{},
+			return SlotsPaths{},
 				errors.New("unknown serialization attribute slot")
 		}
 	}
 	return paths, nil
 }
 
-func (p slotsPaths) isEmpty() bool {
+func (p SlotsPaths) isEmpty() bool {
 	return p.IndexAPath == "" && p.IndexBPath == "" &&
 		p.ValueAPath == "" && p.ValueBPath == ""
 }
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/iden3/go-schema-processor/v2/loaders"
 	"github.com/iden3/go-schema-processor/v2/merklize"
 	tst "github.com/iden3/go-schema-processor/v2/testing"
 	"github.com/piprate/json-gold/ld"
@@ -37,7 +38,7 @@ func TestParser_parseSlots(t *testing.T) {
 	credentialType, err := findCredentialType(mz)
 	require.NoError(t, err)
 
-	slots, nonMerklized, err := parseSlots(mz, credential, credentialType)
+	slots, nonMerklized, err := parseSlots(ctx, mz, credential, credentialType)
 	require.True(t, nonMerklized)
 	require.NoError(t, err)
 	require.NotEqual(t, nullSlot, slots.IndexA)
@@ -46,6 +47,36 @@ func TestParser_parseSlots(t *testing.T) {
 	require.NotEqual(t, nullSlot, slots.ValueB)
 }
 
+func TestParser_parseSlots_CanceledContext(t *testing.T) {
+	defer tst.MockHTTPClient(t,
+		map[string]string{
+			"https://www.w3.org/2018/credentials/v1":              "../merklize/testdata/httpresp/credentials-v1.jsonld",
+			"https://example.com/schema-delivery-address.json-ld": "../json/testdata/schema-delivery-address.json-ld",
+		},
+		tst.IgnoreUntouchedURLs())()
+
+	credentialBytes, err := os.ReadFile("../json/testdata/non-merklized-1.json-ld")
+	require.NoError(t, err)
+
+	var credential W3CCredential
+	err = json.Unmarshal(credentialBytes, &credential)
+	require.NoError(t, err)
+
+	// no cache, so the context is loaded again by parseSlots
+	mz, err := credential.Merklize(context.Background(),
+		merklize.WithDocumentLoader(loaders.NewDocumentLoader(nil, "",
+			loaders.WithCacheEngine(nil))))
+	require.NoError(t, err)
+
+	credentialType, err := findCredentialType(mz)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = parseSlots(ctx, mz, credential, credentialType)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
 func TestGetSerializationAttr(t *testing.T) {
 	defer tst.MockHTTPClient(t,
 		map[string]string{
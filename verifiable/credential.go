@@ -14,6 +14,7 @@ import (
 	"github.com/iden3/go-iden3-crypto/babyjub"
 	"github.com/iden3/go-iden3-crypto/poseidon"
 	"github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-schema-processor/v2/loaders"
 	"github.com/iden3/go-schema-processor/v2/merklize"
 	"github.com/iden3/go-schema-processor/v2/utils"
 	"github.com/pkg/errors"
@@ -34,6 +35,7 @@ type W3CCredential struct {
 	Proof             CredentialProofs       `json:"proof,omitempty"`
 	RefreshService    *RefreshService        `json:"refreshService,omitempty"`
 	DisplayMethod     *DisplayMethod         `json:"displayMethod,omitempty"`
+	RelatedResource   []RelatedResource      `json:"relatedResource,omitempty"`
 }
 
 // VerifyProof verify credential proof
@@ -368,10 +370,14 @@ func getIden3StateInfo2023FromDIDDocument(document DIDDocument) (*CommonVerifica
 	return iden3StateInfo2023, nil
 }
 
-// Merklize merklizes verifiable credential
+// Merklize merklizes verifiable credential. Proofs and RelatedResource are
+// not merklized. Documents listed in RelatedResource with DigestSRI are
+// rejected by the document loader if they don't match the digest.
 func (vc *W3CCredential) Merklize(ctx context.Context,
 	opts ...merklize.MerklizeOption) (*merklize.Merklizer, error) {
 
+	ctx = loaders.ContextWithPinnedDigests(ctx, vc.pinnedDigests())
+
 	credentialBytes, err := json.Marshal(vc)
 	if err != nil {
 		return nil, err
@@ -383,6 +389,10 @@ func (vc *W3CCredential) Merklize(ctx context.Context,
 		return nil, err
 	}
 	delete(credentialAsMap, "proof")
+	// related resources are integrity metadata of the documents the
+	// credential references, and contexts such as credentials/v1 don't
+	// define the term
+	delete(credentialAsMap, "relatedResource")
 
 	credentialWithoutProofBytes, err := json.Marshal(credentialAsMap)
 	if err != nil {
@@ -398,6 +408,21 @@ func (vc *W3CCredential) Merklize(ctx context.Context,
 
 }
 
+// pinnedDigests returns digests of related resources by their URLs
+func (vc *W3CCredential) pinnedDigests() map[string]string {
+	var pins map[string]string
+	for _, r := range vc.RelatedResource {
+		if r.ID == "" || r.DigestSRI == "" {
+			continue
+		}
+		if pins == nil {
+			pins = make(map[string]string, len(vc.RelatedResource))
+		}
+		pins[r.ID] = r.DigestSRI
+	}
+	return pins
+}
+
 // ErrProofNotFound is an error when specific proof is not found in the credential
 var ErrProofNotFound = errors.New("proof not found")
 
@@ -439,7 +464,7 @@ func (vc *W3CCredential) ToCoreClaim(ctx context.Context, opts *CoreClaimOptions
 
 	subjectID := vc.CredentialSubject["id"]
 
-	slots, nonMerklized, err := parseSlots(mz, *vc, credentialType)
+	slots, nonMerklized, err := parseSlots(ctx, mz, *vc, credentialType)
 	if err != nil {
 		return nil, err
 	}
@@ -564,6 +589,15 @@ func WithStatusResolverRegistry(registry *CredentialStatusResolverRegistry) W3CP
 	}
 }
 
+// WithMerklizeOptions sets options used to merklize the credential when its
+// core claim is compared with the claim from the proof, e.g. the document
+// loader
+func WithMerklizeOptions(opts ...merklize.MerklizeOption) W3CProofVerificationOpt {
+	return func(cfg *w3CProofVerificationConfig) {
+		cfg.merklizeOptions = append(cfg.merklizeOptions, opts...)
+	}
+}
+
 // W3CProofVerificationOpt returns configuration options for W3C proof verification
 type W3CProofVerificationOpt func(opts *w3CProofVerificationConfig)
 
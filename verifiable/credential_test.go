@@ -8,6 +8,8 @@ import (
 	"time"
 
 	mt "github.com/iden3/go-merkletree-sql/v2"
+	"github.com/iden3/go-schema-processor/v2/loaders"
+	"github.com/iden3/go-schema-processor/v2/merklize"
 	tst "github.com/iden3/go-schema-processor/v2/testing"
 	"github.com/stretchr/testify/require"
 )
@@ -711,3 +713,50 @@ func TestW3CCredential_MerklizationWithEmptyID(t *testing.T) {
 	_, err = mz.Entry(path)
 	require.NoError(t, err)
 }
+
+func TestW3CCredential_Merklize_RelatedResource(t *testing.T) {
+	const schemaURL = "https://example.com/schema-delivery-address.json-ld"
+	defer tst.MockHTTPClient(t,
+		map[string]string{
+			"https://www.w3.org/2018/credentials/v1": "../merklize/testdata/httpresp/credentials-v1.jsonld",
+			schemaURL:                                "../json/testdata/schema-delivery-address.json-ld",
+		},
+		tst.IgnoreUntouchedURLs())()
+
+	schemaBytes, err := os.ReadFile(
+		"../json/testdata/schema-delivery-address.json-ld")
+	require.NoError(t, err)
+	var schemaDoc any
+	require.NoError(t, json.Unmarshal(schemaBytes, &schemaDoc))
+	digest, err := loaders.DocumentDigest(schemaDoc, "sha384")
+	require.NoError(t, err)
+
+	credentialBytes, err := os.ReadFile(
+		"../json/testdata/non-merklized-1.json-ld")
+	require.NoError(t, err)
+	var vc W3CCredential
+	require.NoError(t, json.Unmarshal(credentialBytes, &vc))
+
+	// no cache, so pinned documents are loaded by every merklization
+	loaderOpt := merklize.WithDocumentLoader(loaders.NewDocumentLoader(nil,
+		"", loaders.WithCacheEngine(nil)))
+
+	mzWithout, err := vc.Merklize(context.Background(), loaderOpt)
+	require.NoError(t, err)
+
+	// credentials/v1 does not define relatedResource, so it is not
+	// merklized and does not change the root
+	vc.RelatedResource = []RelatedResource{{ID: schemaURL,
+		DigestSRI: digest, MediaType: "application/ld+json"}}
+	mz, err := vc.Merklize(context.Background(), loaderOpt)
+	require.NoError(t, err)
+	require.Equal(t, mzWithout.Root().BigInt(), mz.Root().BigInt())
+
+	vc.RelatedResource[0].DigestSRI =
+		"sha384-OLBgp1GsljhM2TJ+sbHjaiH9txEUvgdDTAzHv2P24donTt6/529l+9Ua0vFImLlb"
+	_, err = vc.Merklize(context.Background(), loaderOpt)
+	var mismatchErr *loaders.DigestMismatchError
+	require.ErrorAs(t, err, &mismatchErr)
+	require.Equal(t, schemaURL, mismatchErr.URL)
+	require.Equal(t, digest, mismatchErr.Actual)
+}
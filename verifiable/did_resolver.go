@@ -21,6 +21,18 @@ type HTTPDIDResolver struct {
 	customHTTPClient *http.Client
 }
 
+// NewHTTPDIDResolver creates a resolver that fetches DID documents from the
+// universal resolver at resolverURL. If customHTTPClient is nil,
+// http.DefaultClient is used.
+func NewHTTPDIDResolver(resolverURL string,
+	customHTTPClient *http.Client) *HTTPDIDResolver {
+
+	return &HTTPDIDResolver{
+		resolverURL:      resolverURL,
+		customHTTPClient: customHTTPClient,
+	}
+}
+
 func (r HTTPDIDResolver) Resolve(ctx context.Context, did *w3c.DID) (out DIDDocument, err error) {
 	type didResolutionResult struct {
 		DIDDocument DIDDocument `json:"didDocument"`
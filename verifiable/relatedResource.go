@@ -0,0 +1,12 @@
+package verifiable
+
+// RelatedResource is the integrity information of the resource referenced
+// by the credential, e.g. of a JSON-LD context
+type RelatedResource struct {
+	ID string `json:"id"`
+	// DigestSRI is the digest of the resource in Subresource Integrity
+	// format, see loaders.DocumentDigest. It is verified by loaders created
+	// with loaders.NewDocumentLoader, see loaders.ContextWithPinnedDigests.
+	DigestSRI string `json:"digestSRI,omitempty"`
+	MediaType string `json:"mediaType,omitempty"`
+}
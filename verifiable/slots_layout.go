@@ -0,0 +1,184 @@
+package verifiable
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/piprate/json-gold/ld"
+	"github.com/pkg/errors"
+)
+
+// Names of claim data slots used in iden3_serialization attribute
+const (
+	SlotIndexA = "slotIndexA"
+	SlotIndexB = "slotIndexB"
+	SlotValueA = "slotValueA"
+	SlotValueB = "slotValueB"
+)
+
+// slotIndexes maps slot names to the index of the slot in core claim
+var slotIndexes = map[string]int{
+	SlotIndexA: 2,
+	SlotIndexB: 3,
+	SlotValueA: 6,
+	SlotValueB: 7,
+}
+
+// SlotLayout describes the credentialSubject field serialized into the
+// claim data slot
+type SlotLayout struct {
+	// Slot is the name of the slot: slotIndexA, slotIndexB, slotValueA or
+	// slotValueB
+	Slot string `json:"slot"`
+	// SlotIndex is the index of the slot in core claim (2, 3, 6 or 7)
+	SlotIndex int `json:"slotIndex"`
+	// Field is the path of the field inside credentialSubject, e.g.
+	// postalProviderInformation.insured
+	Field string `json:"field"`
+	// Datatype is the expanded XSD datatype of the field from the context,
+	// e.g. http://www.w3.org/2001/XMLSchema#integer. Empty if the context
+	// does not define @type for the field.
+	Datatype string `json:"datatype"`
+}
+
+// SlotsLayout describes how fields of non-merklized credential type are
+// serialized into core claim data slots
+type SlotsLayout struct {
+	// Serialization is the raw iden3_serialization attribute. Empty for
+	// merklized types.
+	Serialization string `json:"serialization"`
+	// Slots contains only slots with a field assigned, ordered by slot index
+	Slots []SlotLayout `json:"slots"`
+}
+
+// Slots returns slot layouts for the paths ordered by slot index. Slots
+// without field are skipped.
+func (p SlotsPaths) Slots() []SlotLayout {
+	var slots []SlotLayout
+	for _, s := range []struct {
+		name string
+		path string
+	}{
+		{SlotIndexA, p.IndexAPath},
+		{SlotIndexB, p.IndexBPath},
+		{SlotValueA, p.ValueAPath},
+		{SlotValueB, p.ValueBPath},
+	} {
+		if s.path == "" {
+			continue
+		}
+		slots = append(slots, SlotLayout{
+			Slot:      s.name,
+			SlotIndex: slotIndexes[s.name],
+			Field:     s.path,
+		})
+	}
+	return slots
+}
+
+// Field returns the layout of the slot the field is serialized to
+func (l SlotsLayout) Field(field string) (SlotLayout, bool) {
+	for _, s := range l.Slots {
+		if s.Field == field {
+			return s, true
+		}
+	}
+	return SlotLayout{}, false
+}
+
+// SlotsLayoutFromContext returns slots layout of the type from JSON-LD
+// context document. Type may be given either by name or by id. opts are used
+// to parse the context and may be nil.
+func SlotsLayoutFromContext(ctxBytes []byte, typeName string,
+	opts *ld.JsonLdOptions) (SlotsLayout, error) {
+
+	var ctxDoc map[string]any
+	err := json.Unmarshal(ctxBytes, &ctxDoc)
+	if err != nil {
+		return SlotsLayout{}, err
+	}
+
+	ctxObj, ok := ctxDoc[contextFullKey]
+	if !ok {
+		return SlotsLayout{}, errors.New("document has no @context")
+	}
+
+	ldCtx, err := ld.NewContext(nil, opts).Parse(ctxObj)
+	if err != nil {
+		return SlotsLayout{}, err
+	}
+
+	return SlotsLayoutFromParsedContext(ldCtx, typeName)
+}
+
+// SlotsLayoutFromParsedContext returns slots layout of the type from parsed
+// JSON-LD context. Type may be given either by name or by id.
+func SlotsLayoutFromParsedContext(ldCtx *ld.Context,
+	typeName string) (SlotsLayout, error) {
+
+	typeCtxM, err := findTypeContext(ldCtx, typeName)
+	if err != nil {
+		return SlotsLayout{}, err
+	}
+	if typeCtxM == nil {
+		return SlotsLayout{}, fmt.Errorf("type %v not found in context",
+			typeName)
+	}
+
+	var layout SlotsLayout
+	layout.Serialization, _ = typeCtxM[serializationFullKey].(string)
+	if layout.Serialization == "" {
+		return layout, nil
+	}
+
+	sPaths, err := ParseSerializationAttr(layout.Serialization)
+	if err != nil {
+		return SlotsLayout{}, err
+	}
+
+	typeCtx, err := ldCtx.Parse(typeCtxM)
+	if err != nil {
+		return SlotsLayout{}, err
+	}
+
+	layout.Slots = sPaths.Slots()
+	for i := range layout.Slots {
+		layout.Slots[i].Datatype, err = fieldDatatype(typeCtx,
+			layout.Slots[i].Field)
+		if err != nil {
+			return SlotsLayout{}, err
+		}
+	}
+
+	return layout, nil
+}
+
+// fieldDatatype walks the field path in the type-scoped context and returns
+// @type mapping of the last term
+func fieldDatatype(typeCtx *ld.Context, field string) (string, error) {
+	ldCtx := typeCtx
+	terms := strings.Split(field, ".")
+	last := terms[len(terms)-1]
+	for _, term := range terms[:len(terms)-1] {
+		termDef := ldCtx.GetTermDefinition(term)
+		if termDef == nil {
+			return "", fmt.Errorf("field %v not found in context", field)
+		}
+
+		nextCtx, ok := termDef[contextFullKey]
+		if !ok {
+			continue
+		}
+		var err error
+		ldCtx, err = ldCtx.Parse(nextCtx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if ldCtx.GetTermDefinition(last) == nil {
+		return "", fmt.Errorf("field %v not found in context", field)
+	}
+	return ldCtx.GetTypeMapping(last), nil
+}
@@ -0,0 +1,79 @@
+package verifiable
+
+import (
+	"os"
+	"testing"
+
+	"github.com/piprate/json-gold/ld"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlotsLayoutFromContext(t *testing.T) {
+	ctxBytes, err := os.ReadFile("../json/testdata/schema-delivery-address.json-ld")
+	require.NoError(t, err)
+
+	want := SlotsLayout{
+		Serialization: "iden3:v1:slotIndexA=price&slotValueB=postalProviderInformation.insured",
+		Slots: []SlotLayout{
+			{
+				Slot:      SlotIndexA,
+				SlotIndex: 2,
+				Field:     "price",
+				Datatype:  ld.XSDDouble,
+			},
+			{
+				Slot:      SlotValueB,
+				SlotIndex: 7,
+				Field:     "postalProviderInformation.insured",
+				Datatype:  ld.XSDBoolean,
+			},
+		},
+	}
+
+	t.Run("by type name", func(t *testing.T) {
+		layout, err := SlotsLayoutFromContext(ctxBytes,
+			"DeliverAddressMultiTestForked", nil)
+		require.NoError(t, err)
+		require.Equal(t, want, layout)
+
+		slot, ok := layout.Field("postalProviderInformation.insured")
+		require.True(t, ok)
+		require.Equal(t, 7, slot.SlotIndex)
+
+		_, ok = layout.Field("country")
+		require.False(t, ok)
+	})
+
+	t.Run("by type id", func(t *testing.T) {
+		layout, err := SlotsLayoutFromContext(ctxBytes,
+			"urn:uuid:ac2ede19-b3b9-454d-b1a9-a7b3d5763100", nil)
+		require.NoError(t, err)
+		require.Equal(t, want, layout)
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		_, err := SlotsLayoutFromContext(ctxBytes, "UnknownType", nil)
+		require.EqualError(t, err, "type UnknownType not found in context")
+	})
+
+	t.Run("merklized type", func(t *testing.T) {
+		layout, err := SlotsLayoutFromContext(
+			[]byte(AuthBJJJsonLDSchema), "Iden3StateInfo2023", nil)
+		require.NoError(t, err)
+		require.Equal(t, SlotsLayout{}, layout)
+	})
+
+	t.Run("field not in context", func(t *testing.T) {
+		ctx := `{"@context": {
+  "T": {
+    "@id": "urn:t",
+    "@context": {
+      "iden3_serialization": "iden3:v1:slotIndexA=x&slotValueA=y",
+      "x": {"@id": "urn:x", "@type": "http://www.w3.org/2001/XMLSchema#integer"}
+    }
+  }
+}}`
+		_, err := SlotsLayoutFromContext([]byte(ctx), "T", nil)
+		require.EqualError(t, err, "field y not found in context")
+	})
+}